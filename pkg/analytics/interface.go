@@ -0,0 +1,15 @@
+package analytics
+
+import "url-shorter-bot/pkg/models"
+
+type ClickRecorder interface {
+	Record(click models.Click)
+}
+
+type SupabaseInserter interface {
+	Insert(table string, data interface{}) ([]byte, error)
+}
+
+type SupabaseReader interface {
+	Rpc(function string, params interface{}) ([]byte, error)
+}
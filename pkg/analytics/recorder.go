@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+	"url-shorter-bot/pkg/models"
+)
+
+// Recorder buffers clicks in memory and writes them to the clicks table in
+// batches, so redirects never wait for the database.
+type Recorder struct {
+	db            SupabaseInserter
+	events        chan models.Click
+	batchSize     int
+	flushInterval time.Duration
+}
+
+func NewRecorder(db SupabaseInserter, batchSize int, flushInterval time.Duration) *Recorder {
+	return &Recorder{
+		db:            db,
+		events:        make(chan models.Click, batchSize*10),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+	}
+}
+
+// Record queues a click. When the queue is full the click is dropped rather
+// than slowing down the redirect.
+func (r *Recorder) Record(click models.Click) {
+	select {
+	case r.events <- click:
+	default:
+		log.Printf("click queue is full, dropping click for %s", click.Hash)
+	}
+}
+
+// Run writes the queued clicks until ctx is done, then flushes what is left
+// in the queue.
+func (r *Recorder) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.Click, 0, r.batchSize)
+	for {
+		select {
+		case click := <-r.events:
+			batch = append(batch, click)
+			if len(batch) >= r.batchSize {
+				r.write(batch)
+				batch = make([]models.Click, 0, r.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				r.write(batch)
+				batch = make([]models.Click, 0, r.batchSize)
+			}
+		case <-ctx.Done():
+			r.flush(batch)
+			return nil
+		}
+	}
+}
+
+// flush writes batch and the clicks still queued.
+func (r *Recorder) flush(batch []models.Click) {
+	for {
+		select {
+		case click := <-r.events:
+			batch = append(batch, click)
+			if len(batch) >= r.batchSize {
+				r.write(batch)
+				batch = make([]models.Click, 0, r.batchSize)
+			}
+		default:
+			if len(batch) > 0 {
+				r.write(batch)
+			}
+			return
+		}
+	}
+}
+
+func (r *Recorder) write(batch []models.Click) {
+	if _, err := r.db.Insert("clicks", batch); err != nil {
+		log.Printf("insert %d clicks failed: %v", len(batch), err)
+	}
+}
+
+// HashIP pseudonymises a client IP, so unique visitors can be counted
+// without storing addresses.
+func HashIP(ip, salt string) string {
+	sum := sha256.Sum256([]byte(salt + ip))
+	return hex.EncodeToString(sum[:16])
+}
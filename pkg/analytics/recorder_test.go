@@ -0,0 +1,118 @@
+package analytics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"url-shorter-bot/pkg/models"
+)
+
+type mockInserter struct {
+	mu      sync.Mutex
+	batches [][]models.Click
+	done    chan struct{}
+}
+
+func (m *mockInserter) Insert(table string, data interface{}) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if table == "clicks" {
+		m.batches = append(m.batches, data.([]models.Click))
+		m.done <- struct{}{}
+	}
+	return nil, nil
+}
+
+func TestRecorder(t *testing.T) {
+	tests := []struct {
+		name          string
+		batchSize     int
+		flushInterval time.Duration
+		clicks        int
+		stop          bool
+		wantBatches   []int
+	}{
+		{
+			name:          "flush on full batch",
+			batchSize:     2,
+			flushInterval: time.Hour,
+			clicks:        4,
+			wantBatches:   []int{2, 2},
+		},
+		{
+			name:          "flush on interval",
+			batchSize:     10,
+			flushInterval: 10 * time.Millisecond,
+			clicks:        3,
+			wantBatches:   []int{3},
+		},
+		{
+			name:          "flush on shutdown",
+			batchSize:     2,
+			flushInterval: time.Hour,
+			clicks:        5,
+			stop:          true,
+			wantBatches:   []int{2, 2, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockInserter{done: make(chan struct{}, 10)}
+			r := NewRecorder(mock, tt.batchSize, tt.flushInterval)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			for i := 0; i < tt.clicks; i++ {
+				r.Record(models.Click{Hash: "abc"})
+			}
+			if tt.stop {
+				cancel()
+				r.Run(ctx)
+			} else {
+				go r.Run(ctx)
+			}
+
+			for range tt.wantBatches {
+				select {
+				case <-mock.done:
+				case <-time.After(time.Second):
+					t.Fatal("timed out waiting for batch insert")
+				}
+			}
+
+			mock.mu.Lock()
+			defer mock.mu.Unlock()
+			for i, size := range tt.wantBatches {
+				if len(mock.batches[i]) != size {
+					t.Errorf("batch %d: expected %d clicks, got %d", i, size, len(mock.batches[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestRecorder_DropsWhenFull(t *testing.T) {
+	r := NewRecorder(&mockInserter{done: make(chan struct{}, 10)}, 1, time.Hour)
+
+	for i := 0; i < 20; i++ {
+		r.Record(models.Click{Hash: "abc"})
+	}
+
+	if len(r.events) != cap(r.events) {
+		t.Errorf("expected queue to be full, got %d of %d", len(r.events), cap(r.events))
+	}
+}
+
+func TestHashIP(t *testing.T) {
+	if HashIP("203.0.113.1", "salt") != HashIP("203.0.113.1", "salt") {
+		t.Error("expected the same hash for the same ip")
+	}
+	if HashIP("203.0.113.1", "salt") == HashIP("203.0.113.2", "salt") {
+		t.Error("expected different hashes for different ips")
+	}
+	if HashIP("203.0.113.1", "salt") == HashIP("203.0.113.1", "pepper") {
+		t.Error("expected the salt to change the hash")
+	}
+}
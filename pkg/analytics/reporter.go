@@ -0,0 +1,110 @@
+package analytics
+
+import (
+	"encoding/json"
+	"time"
+	"url-shorter-bot/pkg/models"
+)
+
+const dayLayout = "2006-01-02"
+
+// topClicks is how many referrers and countries a report lists.
+const topClicks = 10
+
+// Reporter aggregates recorded clicks into per-link statistics.
+type Reporter struct {
+	db  SupabaseReader
+	now func() time.Time
+}
+
+func NewReporter(db SupabaseReader) *Reporter {
+	return &Reporter{db: db, now: time.Now}
+}
+
+// LinkStats returns the clicks of hash over the last days days, today included.
+// The database aggregates them in one call of link_stats.
+func (r *Reporter) LinkStats(hash string, days int) (models.LinkStats, error) {
+	since := startOfDay(r.now()).AddDate(0, 0, -(days - 1))
+
+	body, err := r.db.Rpc("link_stats", map[string]interface{}{
+		"link_hash": hash,
+		"since":     since.Format(time.RFC3339),
+		"top_n":     topClicks,
+	})
+	if err != nil {
+		return models.LinkStats{}, err
+	}
+
+	var row struct {
+		TotalClicks    int                     `json:"total_clicks"`
+		UniqueVisitors int                     `json:"unique_visitors"`
+		LastClick      *time.Time              `json:"last_click"`
+		PerDay         []models.DayClicks      `json:"per_day"`
+		Referrers      []models.ReferrerClicks `json:"referrers"`
+		Countries      []models.CountryClicks  `json:"countries"`
+	}
+	if err := json.Unmarshal(body, &row); err != nil {
+		return models.LinkStats{}, err
+	}
+
+	stats := models.LinkStats{
+		Hash:           hash,
+		TotalClicks:    row.TotalClicks,
+		UniqueVisitors: row.UniqueVisitors,
+		LastClick:      row.LastClick,
+		PerDay:         perDay(row.PerDay, since, days),
+		Referrers:      row.Referrers,
+		Countries:      row.Countries,
+	}
+	if stats.Referrers == nil {
+		stats.Referrers = []models.ReferrerClicks{}
+	}
+	if stats.Countries == nil {
+		stats.Countries = []models.CountryClicks{}
+	}
+	return stats, nil
+}
+
+// ClickCounts counts every recorded click of each of hashes in one call.
+// Hashes without clicks are left out of the result.
+func (r *Reporter) ClickCounts(hashes []string) (map[string]int, error) {
+	body, err := r.db.Rpc("count_clicks", map[string]interface{}{"hashes": hashes})
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Hash   string `json:"hash"`
+		Clicks int    `json:"clicks"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Hash] = row.Clicks
+	}
+	return counts, nil
+}
+
+// perDay lays the days with clicks out on every day starting at since, empty
+// days included.
+func perDay(clicks []models.DayClicks, since time.Time, days int) []models.DayClicks {
+	counts := map[string]int{}
+	for _, day := range clicks {
+		counts[day.Day] = day.Clicks
+	}
+
+	result := make([]models.DayClicks, days)
+	for i := range result {
+		day := since.AddDate(0, 0, i).Format(dayLayout)
+		result[i] = models.DayClicks{Day: day, Clicks: counts[day]}
+	}
+	return result
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
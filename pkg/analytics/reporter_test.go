@@ -0,0 +1,175 @@
+package analytics
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/models"
+)
+
+type mockReader struct {
+	clicks    []models.Click
+	rpcCalls  int
+	returnErr error
+}
+
+func (m *mockReader) Rpc(function string, params interface{}) ([]byte, error) {
+	if m.returnErr != nil {
+		return nil, m.returnErr
+	}
+	m.rpcCalls++
+
+	counts := map[string]int{}
+	for _, click := range m.clicks {
+		counts[click.Hash]++
+	}
+	rows := []map[string]interface{}{}
+	for _, hash := range params.(map[string]interface{})["hashes"].([]string) {
+		if counts[hash] > 0 {
+			rows = append(rows, map[string]interface{}{"hash": hash, "clicks": counts[hash]})
+		}
+	}
+	return json.Marshal(rows)
+}
+
+func newTestReporter(t *testing.T, clicks []models.Click, now time.Time) *Reporter {
+	t.Helper()
+	db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "clicks.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	for _, click := range clicks {
+		if _, err := db.Insert("clicks", click); err != nil {
+			t.Fatalf("failed to insert click: %v", err)
+		}
+	}
+	r := NewReporter(db)
+	r.now = func() time.Time { return now }
+	return r
+}
+
+func TestReporter_LinkStats(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		clicks        []models.Click
+		wantTotal     int
+		wantUnique    int
+		wantToday     int
+		wantReferrers []models.ReferrerClicks
+		wantCountries []models.CountryClicks
+	}{
+		{
+			name: "aggregates clicks",
+			clicks: []models.Click{
+				{Hash: "abc", Ip_hash: "a", Referrer: "https://t.me/channel", Country: "DE", Created_at: now.AddDate(0, 0, -2)},
+				{Hash: "abc", Ip_hash: "a", Referrer: "https://t.me/other", Country: "DE", Created_at: now.Add(-time.Hour)},
+				{Hash: "abc", Ip_hash: "b", Created_at: now},
+				{Hash: "abc", Ip_hash: "c", Referrer: "https://t.me/old", Created_at: now.AddDate(0, 0, -8)},
+				{Hash: "xyz", Ip_hash: "d", Created_at: now},
+			},
+			wantTotal:  3,
+			wantUnique: 2,
+			wantToday:  2,
+			wantReferrers: []models.ReferrerClicks{
+				{Referrer: "t.me", Clicks: 2},
+				{Referrer: "direct", Clicks: 1},
+			},
+			wantCountries: []models.CountryClicks{{Country: "DE", Clicks: 2}},
+		},
+		{
+			name:          "no clicks",
+			wantReferrers: []models.ReferrerClicks{},
+			wantCountries: []models.CountryClicks{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := newTestReporter(t, tt.clicks, now).LinkStats("abc", 7)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(stats.PerDay) != 7 || stats.PerDay[0].Day != "2025-03-04" || stats.PerDay[6].Day != "2025-03-10" {
+				t.Fatalf("unexpected per day stats: %+v", stats.PerDay)
+			}
+			if stats.TotalClicks != tt.wantTotal || stats.UniqueVisitors != tt.wantUnique || stats.PerDay[6].Clicks != tt.wantToday {
+				t.Errorf("unexpected stats: %+v", stats)
+			}
+			if len(stats.Referrers) != len(tt.wantReferrers) {
+				t.Fatalf("expected referrers %+v, got %+v", tt.wantReferrers, stats.Referrers)
+			}
+			for i, want := range tt.wantReferrers {
+				if stats.Referrers[i] != want {
+					t.Errorf("referrer %d: expected %+v, got %+v", i, want, stats.Referrers[i])
+				}
+			}
+			if len(stats.Countries) != len(tt.wantCountries) {
+				t.Fatalf("expected countries %+v, got %+v", tt.wantCountries, stats.Countries)
+			}
+			for i, want := range tt.wantCountries {
+				if stats.Countries[i] != want {
+					t.Errorf("country %d: expected %+v, got %+v", i, want, stats.Countries[i])
+				}
+			}
+			if tt.wantTotal > 0 && (stats.LastClick == nil || !stats.LastClick.Equal(now)) {
+				t.Errorf("expected last click %v, got %v", now, stats.LastClick)
+			}
+		})
+	}
+}
+
+func TestReporter_TopReferrers(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	clicks := []models.Click{}
+	for i := 0; i < topClicks+5; i++ {
+		clicks = append(clicks, models.Click{Hash: "abc", Referrer: "https://site" + string(rune('a'+i)) + ".com/", Created_at: now})
+	}
+
+	stats, err := newTestReporter(t, clicks, now).LinkStats("abc", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.TotalClicks != topClicks+5 || len(stats.Referrers) != topClicks {
+		t.Errorf("expected %d clicks from the top %d referrers, got %+v", topClicks+5, topClicks, stats)
+	}
+}
+
+func TestReporter_LastClickOutsideWindow(t *testing.T) {
+	old := time.Date(2024, 12, 1, 8, 0, 0, 0, time.UTC)
+	r := newTestReporter(t, []models.Click{{Hash: "abc", Created_at: old}}, time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC))
+
+	stats, err := r.LinkStats("abc", 30)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.TotalClicks != 0 || stats.LastClick == nil || !stats.LastClick.Equal(old) {
+		t.Errorf("expected no clicks in window and last click %v, got %+v", old, stats)
+	}
+}
+
+func TestReporter_LinkStatsError(t *testing.T) {
+	if _, err := NewReporter(&mockReader{returnErr: errors.New("db error")}).LinkStats("abc", 7); err == nil {
+		t.Error("expected the database error")
+	}
+}
+
+func TestReporter_ClickCounts(t *testing.T) {
+	mock := &mockReader{clicks: []models.Click{{Hash: "abc"}, {Hash: "abc"}, {Hash: "xyz"}}}
+
+	counts, err := NewReporter(mock).ClickCounts([]string{"abc", "xyz", "none"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if counts["abc"] != 2 || counts["xyz"] != 1 || counts["none"] != 0 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+	if mock.rpcCalls != 1 {
+		t.Errorf("expected a single call, got %d", mock.rpcCalls)
+	}
+}
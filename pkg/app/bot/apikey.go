@@ -0,0 +1,53 @@
+package bot
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const apiKeyUsage = "Use it as the \"Authorization: Bearer <key>\" header of the HTTP API."
+
+// handleApiKey answers "/apikey" with the state of the caller's key,
+// "/apikey rotate" with a new key and "/apikey revoke" by revoking it.
+func (h *BotHandler) handleApiKey(chatID, telegramID int64, arg string) {
+	switch arg {
+	case "":
+		active, ok, err := h.Keys.Active(telegramID)
+		if err != nil {
+			h.Logger.LogError(telegramID, err.Error(), "500")
+			h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Failed to load your API key."))
+			return
+		}
+		if ok {
+			h.Bot.Send(tgbotapi.NewMessage(chatID, "🔑 Your API key starts with "+active.Prefix+"…\n\nSend /apikey rotate for a new one or /apikey revoke to disable it."))
+			return
+		}
+		h.issueApiKey(chatID, telegramID)
+
+	case "rotate":
+		h.issueApiKey(chatID, telegramID)
+
+	case "revoke":
+		if err := h.Keys.Revoke(telegramID); err != nil {
+			h.Logger.LogError(telegramID, err.Error(), "500")
+			h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Failed to revoke your API key."))
+			return
+		}
+		h.Logger.LogAction(telegramID, "revoked api key")
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "🔒 Your API key was revoked."))
+
+	default:
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "Send /apikey, /apikey rotate or /apikey revoke."))
+	}
+}
+
+func (h *BotHandler) issueApiKey(chatID, telegramID int64) {
+	key, err := h.Keys.Issue(telegramID)
+	if err != nil {
+		h.Logger.LogError(telegramID, err.Error(), "500")
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Failed to create an API key."))
+		return
+	}
+
+	h.Logger.LogAction(telegramID, "issued api key")
+	h.Bot.Send(tgbotapi.NewMessage(chatID, "🔑 Your new API key, it is shown only once:\n\n"+key+"\n\n"+apiKeyUsage+" Any previous key no longer works."))
+}
@@ -2,19 +2,41 @@ package bot
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
-	"net/http"
-	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+	"url-shorter-bot/pkg/analytics"
+	"url-shorter-bot/pkg/app/service"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/cache"
+	"url-shorter-bot/pkg/database"
 	"url-shorter-bot/pkg/models"
+	"url-shorter-bot/pkg/users"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+type stubUsers struct{}
+
+func (u *stubUsers) Resolve(telegramID int64) (string, error) {
+	return fmt.Sprintf("uuid-%d", telegramID), nil
+}
+
+func (u *stubUsers) Register(telegramID int64, nickName string) (string, error) {
+	return u.Resolve(telegramID)
+}
+
 type mockSupabase struct {
-	data map[string]string
+	data     map[string]string
+	owners   map[string]int64
+	disabled map[string]bool
+	clicks   []models.Click
 }
 
 func (m *mockSupabase) Get(table string, target map[string]string) ([]byte, error) {
@@ -25,21 +47,61 @@ func (m *mockSupabase) Get(table string, target map[string]string) ([]byte, erro
 
 	val, exists := m.data[key]
 	if !exists {
-		return nil, fmt.Errorf("no record found for hash: %s", key)
+		return nil, fmt.Errorf("no record found for hash %s: %w", key, database.ErrNotFound)
+	}
+	if owner, ok := target["Telegram_id"]; ok && owner != strconv.FormatInt(m.owners[key], 10) {
+		return nil, fmt.Errorf("no record found for hash %s: %w", key, database.ErrNotFound)
 	}
 
-	result := map[string]string{
-		"Hash":         key,
-		"original_url": val,
+	return json.Marshal(models.Url{
+		Telegram_id: m.owners[key],
+		Hash:        key,
+		Url:         val,
+		Disabled:    m.disabled[key],
+	})
+}
+
+func (m *mockSupabase) Select(table string, query string) ([]byte, error) {
+	switch table {
+	case "urls":
+		links := []models.Url{}
+		for hash, target := range m.data {
+			if strings.Contains(query, "Telegram_id=eq."+strconv.FormatInt(m.owners[hash], 10)+"&") {
+				links = append(links, models.Url{Telegram_id: m.owners[hash], Hash: hash, Url: target, Disabled: m.disabled[hash]})
+			}
+		}
+		sort.Slice(links, func(i, j int) bool { return links[i].Hash < links[j].Hash })
+
+		values, _ := url.ParseQuery(query)
+		if offset, err := strconv.Atoi(values.Get("offset")); err == nil {
+			links = links[min(offset, len(links)):]
+		}
+		if limit, err := strconv.Atoi(values.Get("limit")); err == nil {
+			links = links[:min(limit, len(links))]
+		}
+		return json.Marshal(links)
 	}
+	return []byte(`[]`), nil
+}
 
-	return json.Marshal(result)
+func (m *mockSupabase) Count(table string, filter string) (int, error) {
+	count := 0
+	for _, click := range m.clicks {
+		if filter == "Hash=eq."+click.Hash {
+			count++
+		}
+	}
+	return count, nil
 }
 
 func (m *mockSupabase) Insert(table string, data interface{}) ([]byte, error) {
 	if m.data == nil {
 		m.data = map[string]string{}
 	}
+	switch data.(type) {
+	case models.UrlHistory:
+		return []byte(`[]`), nil
+	}
 	u, ok := data.(models.Url)
 	if !ok {
 		return nil, fmt.Errorf("invalid format")
@@ -48,33 +110,133 @@ func (m *mockSupabase) Insert(table string, data interface{}) ([]byte, error) {
 	return json.Marshal(u)
 }
 
+func (m *mockSupabase) Update(table string, filter string, data interface{}) ([]byte, error) {
+	if m.disabled == nil {
+		m.disabled = map[string]bool{}
+	}
+	fields := data.(map[string]interface{})
+	for _, part := range strings.Split(filter, "&") {
+		if hash, ok := strings.CutPrefix(part, "Hash=eq."); ok {
+			if disabled, ok := fields["Disabled"]; ok {
+				m.disabled[hash] = disabled.(bool)
+			}
+			if target, ok := fields["Url"]; ok {
+				m.data[hash] = target.(string)
+			}
+		}
+	}
+	return []byte(`[]`), nil
+}
+
 func (m *mockSupabase) Delete(table string, filter string) ([]byte, error) {
-	delete(m.data, "12345")
+	if table != "urls" {
+		return []byte(`[]`), nil
+	}
+	for _, part := range strings.Split(filter, "&") {
+		if hash, ok := strings.CutPrefix(part, "Hash=eq."); ok {
+			delete(m.data, hash)
+		}
+	}
 	return []byte(`{}`), nil
 }
 
+func (m *mockSupabase) Rpc(function string, params interface{}) ([]byte, error) {
+	switch function {
+	case "count_clicks":
+	case "link_stats":
+		return m.linkStats(params.(map[string]interface{})["link_hash"].(string))
+	case "take_link_quota":
+		return []byte(`[{"allowed": true, "creation": "c1"}]`), nil
+	default:
+		return nil, fmt.Errorf("unknown function: %s", function)
+	}
+	counts := map[string]int{}
+	for _, click := range m.clicks {
+		counts[click.Hash]++
+	}
+	rows := []map[string]interface{}{}
+	for _, hash := range params.(map[string]interface{})["hashes"].([]string) {
+		if counts[hash] > 0 {
+			rows = append(rows, map[string]interface{}{"hash": hash, "clicks": counts[hash]})
+		}
+	}
+	return json.Marshal(rows)
+}
+
+// linkStats counts every click of hash with its referrer host.
+func (m *mockSupabase) linkStats(hash string) ([]byte, error) {
+	total, visitors, referrers := 0, map[string]bool{}, map[string]int{}
+	for _, click := range m.clicks {
+		if click.Hash == hash {
+			total++
+			visitors[click.Ip_hash] = true
+			if u, err := url.Parse(click.Referrer); err == nil {
+				referrers[u.Host]++
+			}
+		}
+	}
+	rows := []models.ReferrerClicks{}
+	for referrer, clicks := range referrers {
+		rows = append(rows, models.ReferrerClicks{Referrer: referrer, Clicks: clicks})
+	}
+	return json.Marshal(map[string]interface{}{"total_clicks": total, "unique_visitors": len(visitors), "referrers": rows})
+}
+
+type mockLogger struct {
+	errors []string
+}
+
+func (l *mockLogger) LogAction(telegramID int64, action string) {}
+func (l *mockLogger) LogError(telegramID int64, errMsg, code string) {
+	l.errors = append(l.errors, errMsg)
+}
+
 type mockBotAPI struct {
+	sendErr      error
 	sentMessages []tgbotapi.Chattable
+	requests     []tgbotapi.Chattable
+	endpoints    []string
+	params       []tgbotapi.Params
 }
 
 func (m *mockBotAPI) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
 	m.sentMessages = append(m.sentMessages, c)
-	return tgbotapi.Message{}, nil
+	return tgbotapi.Message{}, m.sendErr
+}
+
+func (m *mockBotAPI) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	m.requests = append(m.requests, c)
+	return &tgbotapi.APIResponse{Ok: true}, nil
 }
 
+func (m *mockBotAPI) MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	m.endpoints = append(m.endpoints, endpoint)
+	m.params = append(m.params, params)
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (m *mockBotAPI) StopReceivingUpdates() {}
+
 func (m *mockBotAPI) GetUpdatesChan(u tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel {
 	ch := make(chan tgbotapi.Update)
 	close(ch)
 	return tgbotapi.UpdatesChannel(ch)
 }
 
+type fixedGenerator struct {
+	code string
+}
+
+func (g *fixedGenerator) Generate(seed string, attempt int) (string, error) {
+	return g.code, nil
+}
+
 func TestHandleMessages(t *testing.T) {
 	tests := []struct {
 		name           string
 		initialState   string
+		initialPending string
 		inputText      string
-		mockHTTPStatus int
-		mockHTTPBody   string
 		expectedReply  string
 	}{
 		{
@@ -88,19 +250,58 @@ func TestHandleMessages(t *testing.T) {
 			expectedReply: "Please send the URL you want to shorten.",
 		},
 		{
-			name:           "valid URL shorten",
-			inputText:      "https://google.com",
-			initialState:   "awaiting_url",
-			mockHTTPStatus: http.StatusOK,
-			mockHTTPBody:   `{"Url": "http://short.ly/abc123"}`,
+			name:          "valid URL asks for code choice",
+			inputText:     "https://google.com",
+			initialState:  "awaiting_url",
+			expectedReply: "How should the short link look?",
+		},
+		{
+			name:          "invalid URL",
+			inputText:     "google",
+			initialState:  "awaiting_url",
+			expectedReply: "❌ Failed to shorten URL.",
+		},
+		{
+			name:           "random code shorten",
+			inputText:      "Random code",
+			initialState:   "awaiting_code_choice",
+			initialPending: "https://google.com",
 			expectedReply:  "✅ Shortened URL: http://short.ly/abc123",
 		},
 		{
-			name:           "rate limited",
-			inputText:      "https://too-many.com",
-			initialState:   "awaiting_url",
-			mockHTTPStatus: http.StatusTooManyRequests,
-			expectedReply:  "Too Many Request",
+			name:           "URL with quotes",
+			inputText:      "Random code",
+			initialState:   "awaiting_code_choice",
+			initialPending: `https://google.com/search?q="go"`,
+			expectedReply:  "✅ Shortened URL: http://short.ly/abc123",
+		},
+		{
+			name:           "custom alias button",
+			inputText:      "Custom alias",
+			initialState:   "awaiting_code_choice",
+			initialPending: "https://google.com",
+			expectedReply:  "Send the alias",
+		},
+		{
+			name:           "custom alias shorten",
+			inputText:      "spring-sale",
+			initialState:   "awaiting_alias",
+			initialPending: "https://google.com",
+			expectedReply:  "✅ Shortened URL: http://short.ly/spring-sale",
+		},
+		{
+			name:           "custom alias taken",
+			inputText:      "taken-alias",
+			initialState:   "awaiting_alias",
+			initialPending: "https://google.com",
+			expectedReply:  "❌ This alias is already taken. Send another one.",
+		},
+		{
+			name:           "custom alias invalid",
+			inputText:      "api",
+			initialState:   "awaiting_alias",
+			initialPending: "https://google.com",
+			expectedReply:  "❌ Invalid alias",
 		},
 		{
 			name:          "unknown input",
@@ -110,42 +311,35 @@ func TestHandleMessages(t *testing.T) {
 	}
 
 	originalHost := models.Config.HostName
-	originalPort := models.Config.Port
+	originalProtocol := models.Protocol
 	defer func() {
 		models.Config.HostName = originalHost
-		models.Config.Port = originalPort
+		models.Protocol = originalProtocol
 	}()
+	models.Config.HostName = "short.ly"
+	models.Protocol = "http"
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockBot := &mockBotAPI{}
 			state := NewStateStore()
-			db := &mockSupabase{}
+			db := &mockSupabase{
+				data:   map[string]string{"taken-alias": "https://someone-else.com"},
+				owners: map[string]int64{"taken-alias": 1},
+			}
 
 			if tt.initialState != "" {
 				state.Set(12345, tt.initialState)
-			}
-
-			if tt.mockHTTPStatus != 0 {
-				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					w.WriteHeader(tt.mockHTTPStatus)
-					w.Write([]byte(tt.mockHTTPBody))
-				}))
-				defer server.Close()
-
-				hostPort := strings.TrimPrefix(server.URL, "http://")
-				host, port, err := net.SplitHostPort(hostPort)
-				if err != nil {
-					t.Fatalf("failed to parse test server URL: %v", err)
-				}
-				models.Config.HostName = host
-				models.Config.Port = port
+				state.SetPending(12345, tt.initialPending)
 			}
 
 			handler := &BotHandler{
-				Bot:   mockBot,
-				State: state,
-				Db:    db,
+				Bot:       mockBot,
+				State:     state,
+				Db:        db,
+				Logger:    &mockLogger{},
+				Shortener: service.NewShortenerService(db, &fixedGenerator{code: "abc123"}, service.Quota{}, &stubUsers{}),
+				Users:     &stubUsers{},
 			}
 
 			update := tgbotapi.Update{
@@ -156,7 +350,7 @@ func TestHandleMessages(t *testing.T) {
 				},
 			}
 
-			processMessage(handler, update)
+			handler.handleMessage(update.Message)
 
 			if len(mockBot.sentMessages) == 0 {
 				t.Fatal("No messages were sent")
@@ -171,86 +365,428 @@ func TestHandleMessages(t *testing.T) {
 }
 
 func TestRateLimitBehavior(t *testing.T) {
-	callCount := 0
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		callCount++
-		if callCount <= 2 {
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(`{"Url": "http://short.ly/success"}`))
-		} else {
-			w.WriteHeader(http.StatusTooManyRequests)
-			w.Write([]byte("Too Many Request"))
-		}
-	}))
-	defer server.Close()
-
-	parts := strings.Split(strings.TrimPrefix(server.URL, "http://"), ":")
-	models.Config.HostName = parts[0]
-	models.Config.Port = parts[1]
+	db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	generator, err := shortcode.NewGenerator("random", "", 0)
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
 
 	state := NewStateStore()
 	mockBot := &mockBotAPI{}
 	handler := &BotHandler{
-		Bot:   mockBot,
-		State: state,
+		Bot:       mockBot,
+		State:     state,
+		Logger:    &mockLogger{},
+		Shortener: service.NewShortenerService(db, generator, service.Quota{PerMinute: 2}, users.NewResolver(db, cache.NewMemoryCache(time.Minute, time.Minute))),
 	}
 
 	chatID := int64(777)
 
 	for i := 1; i <= 3; i++ {
-		state.Set(chatID, "awaiting_url")
+		state.Set(chatID, "awaiting_code_choice")
+		state.SetPending(chatID, fmt.Sprintf("https://spam.com/%d", i))
 		update := tgbotapi.Update{
 			Message: &tgbotapi.Message{
-				Text: "https://spam.com",
+				Text: "Random code",
 				Chat: &tgbotapi.Chat{ID: chatID},
 				From: &tgbotapi.User{ID: 999},
 			},
 		}
-		processMessage(handler, update)
+		handler.handleMessage(update.Message)
 	}
 
 	if len(mockBot.sentMessages) != 3 {
 		t.Fatalf("expected 3 responses, got %d", len(mockBot.sentMessages))
 	}
 
+	second := mockBot.sentMessages[1].(tgbotapi.MessageConfig)
+	if !strings.HasPrefix(second.Text, "✅ Shortened URL") {
+		t.Errorf("expected the second link to be created, got: %q", second.Text)
+	}
 	last := mockBot.sentMessages[2].(tgbotapi.MessageConfig)
-	if !strings.Contains(last.Text, "Too Many Request") {
-		t.Errorf("expected last reply to be rate limit, got: %q", last.Text)
+	if !strings.Contains(last.Text, "limit of new links") {
+		t.Errorf("expected last reply to be the quota, got: %q", last.Text)
+	}
+	if state.Get(chatID) != "" {
+		t.Errorf("expected the chat state to be cleared, got %q", state.Get(chatID))
 	}
 }
 
-func processMessage(h *BotHandler, update tgbotapi.Update) {
-	chatID := update.Message.Chat.ID
-	text := update.Message.Text
-	telegramID := update.Message.From.ID
-
-	switch {
-	case text == "/start":
-		msg := tgbotapi.NewMessage(chatID, "👋 Welcome! Click the button below to shorten a URL.")
-		msg.ReplyMarkup = UrlShortenKeyboard()
-		h.Bot.Send(msg)
-
-	case text == "Shorten URL":
-		h.State.Set(chatID, "awaiting_url")
-		msg := tgbotapi.NewMessage(chatID, "Please send the URL you want to shorten.")
-		h.Bot.Send(msg)
-
-	case h.State.Get(chatID) == "awaiting_url":
-		h.State.Clear(chatID)
-		shortURL, err := h.shortenURL(text, telegramID)
-		if err != nil || shortURL == "" {
-			h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Failed to shorten URL."))
-			return
-		}
-		if shortURL == "Too Many Request" {
-			h.Bot.Send(tgbotapi.NewMessage(chatID, "Too Many Request"))
-			return
-		}
-		h.Bot.Send(tgbotapi.NewMessage(chatID, "✅ Shortened URL: "+shortURL))
+func TestStatsCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		inputText     string
+		links         map[string]string
+		expectedReply []string
+	}{
+		{
+			name:          "list links with clicks",
+			inputText:     "/stats",
+			links:         map[string]string{"abc": "https://example.com"},
+			expectedReply: []string{"📊 Your links:", "/abc → https://example.com", "2 clicks"},
+		},
+		{
+			name:          "long destination is cut",
+			inputText:     "/stats",
+			links:         map[string]string{"abc": "https://example.com/" + strings.Repeat("a", 100)},
+			expectedReply: []string{"/abc → https://example.com/" + strings.Repeat("a", 39) + "…\n", "2 clicks"},
+		},
+		{
+			name:          "no links",
+			inputText:     "/stats",
+			links:         map[string]string{},
+			expectedReply: []string{"You have no short links yet."},
+		},
+		{
+			name:          "single link report",
+			inputText:     "/stats abc",
+			links:         map[string]string{"abc": "https://example.com"},
+			expectedReply: []string{"Clicks in the last 30 days: 2", "Unique visitors: 1", "t.me: 2"},
+		},
+		{
+			name:          "someone else's link",
+			inputText:     "/stats xyz",
+			links:         map[string]string{"xyz": "https://example.com"},
+			expectedReply: []string{"❌ Link not found."},
+		},
+	}
 
-	default:
-		msg := tgbotapi.NewMessage(chatID, "❓ I don't understand. Use the button or type /start.")
-		h.Bot.Send(msg)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBot := &mockBotAPI{}
+			owners := map[string]int64{"abc": 999, "xyz": 111}
+			db := &mockSupabase{
+				data:   tt.links,
+				owners: owners,
+				clicks: []models.Click{
+					{Hash: "abc", Ip_hash: "a", Referrer: "https://t.me/channel", Created_at: time.Now()},
+					{Hash: "abc", Ip_hash: "a", Referrer: "https://t.me/channel", Created_at: time.Now()},
+				},
+			}
+			handler := &BotHandler{
+				Bot:    mockBot,
+				State:  NewStateStore(),
+				Db:     db,
+				Logger: &mockLogger{},
+				Stats:  analytics.NewReporter(db),
+				Links:  service.NewLinkService(db, cache.NewMemoryCache(time.Minute, time.Minute)),
+			}
+
+			handler.handleMessage(&tgbotapi.Message{
+				Text: tt.inputText,
+				Chat: &tgbotapi.Chat{ID: 12345},
+				From: &tgbotapi.User{ID: 999},
+			})
+
+			if len(mockBot.sentMessages) != 1 {
+				t.Fatalf("expected 1 message, got %d", len(mockBot.sentMessages))
+			}
+			last := mockBot.sentMessages[0].(tgbotapi.MessageConfig)
+			for _, expected := range tt.expectedReply {
+				if !strings.Contains(last.Text, expected) {
+					t.Errorf("Expected reply to contain %q, got %q", expected, last.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestStatsCommand_SendError(t *testing.T) {
+	mockBot := &mockBotAPI{sendErr: errors.New("Bad Request: message is too long")}
+	log := &mockLogger{}
+	db := &mockSupabase{data: map[string]string{"abc": "https://example.com"}, owners: map[string]int64{"abc": 999}}
+	handler := &BotHandler{
+		Bot:    mockBot,
+		State:  NewStateStore(),
+		Db:     db,
+		Logger: log,
+		Stats:  analytics.NewReporter(db),
+		Links:  service.NewLinkService(db, cache.NewMemoryCache(time.Minute, time.Minute)),
+	}
+
+	for _, text := range []string{"/stats", "/list"} {
+		handler.handleMessage(&tgbotapi.Message{
+			Text: text,
+			Chat: &tgbotapi.Chat{ID: 12345},
+			From: &tgbotapi.User{ID: 999},
+		})
+	}
+
+	if len(log.errors) != 2 || !strings.Contains(log.errors[0], "message is too long") {
+		t.Fatalf("expected both send errors to be logged, got %q", log.errors)
+	}
+}
+
+func TestListCommand(t *testing.T) {
+	links := map[string]string{}
+	owners := map[string]int64{}
+	for i := 1; i <= 7; i++ {
+		hash := fmt.Sprintf("link%d", i)
+		links[hash] = "https://example.com/" + hash
+		owners[hash] = 999
+	}
+	links["other"] = "https://example.com/other"
+	owners["other"] = 111
+
+	mockBot := &mockBotAPI{}
+	db := &mockSupabase{data: links, owners: owners}
+	handler := &BotHandler{
+		Bot:    mockBot,
+		State:  NewStateStore(),
+		Db:     db,
+		Logger: &mockLogger{},
+		Stats:  analytics.NewReporter(db),
+		Links:  service.NewLinkService(db, cache.NewMemoryCache(time.Minute, time.Minute)),
+	}
+
+	handler.handleMessage(&tgbotapi.Message{
+		Text: "/list",
+		Chat: &tgbotapi.Chat{ID: 12345},
+		From: &tgbotapi.User{ID: 999},
+	})
+
+	first := mockBot.sentMessages[0].(tgbotapi.MessageConfig)
+	if !strings.Contains(first.Text, "/link1 → https://example.com/link1") || strings.Contains(first.Text, "link6") {
+		t.Fatalf("unexpected first page: %q", first.Text)
+	}
+	keyboard := first.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	if len(keyboard.InlineKeyboard) != listPageSize+1 {
+		t.Fatalf("expected %d keyboard rows, got %d", listPageSize+1, len(keyboard.InlineKeyboard))
+	}
+	if next := keyboard.InlineKeyboard[listPageSize]; len(next) != 1 || *next[0].CallbackData != "list:1" {
+		t.Fatalf("expected a single Next button, got %+v", next)
+	}
+
+	tests := []struct {
+		name         string
+		from         int64
+		data         string
+		expectedText string
+		expectAnswer string
+		remaining    int
+	}{
+		{name: "next page", from: 999, data: "list:1", expectedText: "/link7", remaining: 8},
+		{name: "stats button", from: 999, data: "stats:link2", expectedText: "Clicks in the last 30 days: 0", remaining: 8},
+		{name: "copy button", from: 999, data: "copy:link3", expectedText: "/link3", remaining: 8},
+		{name: "delete button", from: 999, data: "delete:1:link6", expectedText: "/link7", expectAnswer: "🗑 Deleted link6", remaining: 7},
+		{name: "delete someone else's link", from: 999, data: "delete:0:other", expectAnswer: "❌ Link not found.", remaining: 8},
+		{name: "disable button", from: 999, data: "disable:0:link2", expectedText: "/link2 → https://example.com/link2 (disabled)", expectAnswer: "⏸ Disabled link2", remaining: 8},
+		{name: "enable button", from: 999, data: "enable:0:link2", expectedText: "/link2 → https://example.com/link2\n", expectAnswer: "▶️ Enabled link2", remaining: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBot := &mockBotAPI{}
+			db := &mockSupabase{data: map[string]string{}, owners: owners}
+			for hash, target := range links {
+				db.data[hash] = target
+			}
+			handler := &BotHandler{
+				Bot:    mockBot,
+				State:  NewStateStore(),
+				Db:     db,
+				Logger: &mockLogger{},
+				Stats:  analytics.NewReporter(db),
+				Links:  service.NewLinkService(db, cache.NewMemoryCache(time.Minute, time.Minute)),
+			}
+
+			handler.handleCallback(&tgbotapi.CallbackQuery{
+				ID:      "1",
+				From:    &tgbotapi.User{ID: tt.from},
+				Message: &tgbotapi.Message{MessageID: 42, Chat: &tgbotapi.Chat{ID: 12345}},
+				Data:    tt.data,
+			})
+
+			if len(mockBot.requests) != 1 {
+				t.Fatalf("expected the callback to be answered once, got %d", len(mockBot.requests))
+			}
+			if answer := mockBot.requests[0].(tgbotapi.CallbackConfig); answer.Text != tt.expectAnswer {
+				t.Errorf("expected answer %q, got %q", tt.expectAnswer, answer.Text)
+			}
+			if len(db.data) != tt.remaining {
+				t.Errorf("expected %d links left, got %d", tt.remaining, len(db.data))
+			}
+			if tt.expectedText == "" {
+				return
+			}
+
+			if len(mockBot.sentMessages) != 1 {
+				t.Fatalf("expected 1 message, got %d", len(mockBot.sentMessages))
+			}
+			var text string
+			switch msg := mockBot.sentMessages[0].(type) {
+			case tgbotapi.MessageConfig:
+				text = msg.Text
+			case tgbotapi.EditMessageTextConfig:
+				text = msg.Text
+				if msg.MessageID != 42 {
+					t.Errorf("expected message 42 to be edited, got %d", msg.MessageID)
+				}
+			}
+			if !strings.Contains(text, tt.expectedText) {
+				t.Errorf("expected reply to contain %q, got %q", tt.expectedText, text)
+			}
+		})
+	}
+}
+
+func TestDeleteCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		inputText     string
+		expectedReply string
+		remaining     int
+	}{
+		{name: "own link", inputText: "/delete abc", expectedReply: "🗑 Deleted abc", remaining: 1},
+		{name: "someone else's link", inputText: "/delete xyz", expectedReply: "❌ Link not found.", remaining: 2},
+		{name: "missing code", inputText: "/delete", expectedReply: "Send /delete <code>", remaining: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBot := &mockBotAPI{}
+			db := &mockSupabase{
+				data:   map[string]string{"abc": "https://a.com", "xyz": "https://x.com"},
+				owners: map[string]int64{"abc": 999, "xyz": 111},
+			}
+			c := cache.NewMemoryCache(time.Minute, time.Minute)
+			c.Set("abc", "https://a.com", time.Minute)
+
+			handler := &BotHandler{
+				Bot:    mockBot,
+				State:  NewStateStore(),
+				Db:     db,
+				Logger: &mockLogger{},
+				Links:  service.NewLinkService(db, c),
+			}
+
+			handler.handleMessage(&tgbotapi.Message{
+				Text: tt.inputText,
+				Chat: &tgbotapi.Chat{ID: 12345},
+				From: &tgbotapi.User{ID: 999},
+			})
+
+			last := mockBot.sentMessages[len(mockBot.sentMessages)-1].(tgbotapi.MessageConfig)
+			if !strings.Contains(last.Text, tt.expectedReply) {
+				t.Errorf("Expected reply to contain %q, got %q", tt.expectedReply, last.Text)
+			}
+			if len(db.data) != tt.remaining {
+				t.Errorf("expected %d links left, got %d", tt.remaining, len(db.data))
+			}
+			if _, cached := c.Get("abc"); cached == (tt.remaining == 1) {
+				t.Errorf("expected the cache to be evicted only when the link is deleted")
+			}
+		})
+	}
+}
+
+func TestEditCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		initialState  string
+		inputText     string
+		expectedReply string
+		expectedState string
+		expectedURL   string
+	}{
+		{name: "start editing", inputText: "/edit abc", expectedReply: "Send the new destination URL for", expectedState: "awaiting_new_url", expectedURL: "https://a.com"},
+		{name: "someone else's link", inputText: "/edit xyz", expectedReply: "❌ Link not found.", expectedURL: "https://a.com"},
+		{name: "new url", initialState: "awaiting_new_url", inputText: "https://moved.com", expectedReply: "now points to https://moved.com", expectedURL: "https://moved.com"},
+		{name: "invalid new url", initialState: "awaiting_new_url", inputText: "moved", expectedReply: "❌ Invalid URL. Send another one.", expectedState: "awaiting_new_url", expectedURL: "https://a.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBot := &mockBotAPI{}
+			state := NewStateStore()
+			db := &mockSupabase{
+				data:   map[string]string{"abc": "https://a.com", "xyz": "https://x.com"},
+				owners: map[string]int64{"abc": 999, "xyz": 111},
+			}
+			if tt.initialState != "" {
+				state.Set(12345, tt.initialState)
+				state.SetPending(12345, "abc")
+			}
+
+			handler := &BotHandler{
+				Bot:    mockBot,
+				State:  state,
+				Db:     db,
+				Logger: &mockLogger{},
+				Links:  service.NewLinkService(db, cache.NewMemoryCache(time.Minute, time.Minute)),
+			}
+
+			handler.handleMessage(&tgbotapi.Message{
+				Text: tt.inputText,
+				Chat: &tgbotapi.Chat{ID: 12345},
+				From: &tgbotapi.User{ID: 999},
+			})
+
+			last := mockBot.sentMessages[len(mockBot.sentMessages)-1].(tgbotapi.MessageConfig)
+			if !strings.Contains(last.Text, tt.expectedReply) {
+				t.Errorf("Expected reply to contain %q, got %q", tt.expectedReply, last.Text)
+			}
+			if got := state.Get(12345); got != tt.expectedState {
+				t.Errorf("expected state %q, got %q", tt.expectedState, got)
+			}
+			if db.data["abc"] != tt.expectedURL {
+				t.Errorf("expected destination %q, got %q", tt.expectedURL, db.data["abc"])
+			}
+		})
+	}
+}
+
+func TestApiKeyCommand(t *testing.T) {
+	db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+
+	mockBot := &mockBotAPI{}
+	handler := &BotHandler{
+		Bot:    mockBot,
+		State:  NewStateStore(),
+		Db:     db,
+		Logger: &mockLogger{},
+		Keys:   service.NewApiKeyService(db),
+	}
+
+	send := func(text string) string {
+		handler.handleMessage(&tgbotapi.Message{
+			Text: text,
+			Chat: &tgbotapi.Chat{ID: 12345},
+			From: &tgbotapi.User{ID: 999},
+		})
+		return mockBot.sentMessages[len(mockBot.sentMessages)-1].(tgbotapi.MessageConfig).Text
+	}
+
+	reply := send("/apikey")
+	key := strings.Fields(strings.SplitN(reply, "\n\n", 3)[1])[0]
+	if !strings.Contains(reply, "shown only once") || !strings.HasPrefix(key, "usb_") {
+		t.Fatalf("expected a new key, got %q", reply)
+	}
+	if id, err := handler.Keys.Resolve(key); err != nil || id != 999 {
+		t.Fatalf("expected the key to belong to 999, got %d (%v)", id, err)
+	}
+
+	if reply := send("/apikey"); !strings.Contains(reply, "starts with "+key[:10]) {
+		t.Errorf("expected the active key prefix, got %q", reply)
+	}
+
+	if reply := send("/apikey rotate"); strings.Contains(reply, key) || !strings.Contains(reply, "usb_") {
+		t.Errorf("expected a different key, got %q", reply)
+	}
+	if _, err := handler.Keys.Resolve(key); err == nil {
+		t.Errorf("expected the rotated key to stop working")
+	}
+
+	if reply := send("/apikey revoke"); !strings.Contains(reply, "revoked") {
+		t.Errorf("expected revoke confirmation, got %q", reply)
+	}
+	if _, ok, _ := handler.Keys.Active(999); ok {
+		t.Errorf("expected no active key after revoke")
 	}
 }
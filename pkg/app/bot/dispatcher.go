@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"sync"
+	"sync/atomic"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DispatcherStats is a snapshot of the update queues.
+type DispatcherStats struct {
+	Queued    int    // updates waiting in the queues
+	Processed uint64 // updates handled since start
+	Blocked   uint64 // updates that waited for a full queue
+}
+
+// Dispatcher handles updates on a pool of workers. Updates of one chat always
+// go to the same worker, so they are handled one by one and in order, while
+// slow chats do not hold up the others.
+type Dispatcher struct {
+	handle    func(tgbotapi.Update)
+	queues    []chan tgbotapi.Update
+	wg        sync.WaitGroup
+	processed atomic.Uint64
+	blocked   atomic.Uint64
+}
+
+// NewDispatcher starts workers goroutines, each with a queue of queueSize
+// updates.
+func NewDispatcher(workers, queueSize int, handle func(tgbotapi.Update)) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+
+	d := &Dispatcher{handle: handle, queues: make([]chan tgbotapi.Update, workers)}
+	for i := range d.queues {
+		d.queues[i] = make(chan tgbotapi.Update, queueSize)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+	return d
+}
+
+// Dispatch queues update for the worker of its chat. It blocks while that
+// queue is full, which slows down polling or the webhook instead of
+// buffering without bound.
+func (d *Dispatcher) Dispatch(update tgbotapi.Update) {
+	queue := d.queues[shard(chatOf(update), len(d.queues))]
+
+	select {
+	case queue <- update:
+	default:
+		d.blocked.Add(1)
+		queue <- update
+	}
+}
+
+// Close stops accepting updates and waits until the queued ones are handled.
+func (d *Dispatcher) Close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) Stats() DispatcherStats {
+	stats := DispatcherStats{Processed: d.processed.Load(), Blocked: d.blocked.Load()}
+	for _, queue := range d.queues {
+		stats.Queued += len(queue)
+	}
+	return stats
+}
+
+func (d *Dispatcher) work(queue <-chan tgbotapi.Update) {
+	defer d.wg.Done()
+	for update := range queue {
+		d.handle(update)
+		d.processed.Add(1)
+	}
+}
+
+// chatOf returns the chat an update belongs to.
+func chatOf(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return update.CallbackQuery.Message.Chat.ID
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.From.ID
+	}
+	return 0
+}
+
+func shard(chatID int64, n int) int {
+	// group chats have negative IDs
+	return int(uint64(chatID) % uint64(n))
+}
@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func messageUpdate(updateID int, chatID int64) tgbotapi.Update {
+	return tgbotapi.Update{
+		UpdateID: updateID,
+		Message:  &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}},
+	}
+}
+
+func TestDispatcher_OrderPerChat(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[int64][]int{}
+
+	d := NewDispatcher(4, 2, func(update tgbotapi.Update) {
+		mu.Lock()
+		defer mu.Unlock()
+		chatID := update.Message.Chat.ID
+		seen[chatID] = append(seen[chatID], update.UpdateID)
+	})
+
+	chats := []int64{1, 2, 3, -100500, 7}
+	for i := 0; i < 200; i++ {
+		d.Dispatch(messageUpdate(i, chats[i%len(chats)]))
+	}
+	d.Close()
+
+	total := 0
+	for chatID, ids := range seen {
+		total += len(ids)
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Fatalf("chat %d: update %d handled after %d", chatID, ids[i], ids[i-1])
+			}
+		}
+	}
+	if total != 200 {
+		t.Errorf("expected every update to be handled before Close returns, got %d", total)
+	}
+	if stats := d.Stats(); stats.Processed != 200 || stats.Queued != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDispatcher_SlowChat(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan int64, 10)
+
+	d := NewDispatcher(2, 1, func(update tgbotapi.Update) {
+		if update.Message.Chat.ID == 2 {
+			<-release
+		}
+		done <- update.Message.Chat.ID
+	})
+	defer d.Close()
+
+	d.Dispatch(messageUpdate(1, 2))
+	d.Dispatch(messageUpdate(2, 1))
+
+	select {
+	case chatID := <-done:
+		if chatID != 1 {
+			t.Errorf("expected chat 1 to be handled first, got %d", chatID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow chat blocked another chat")
+	}
+	close(release)
+	<-done
+}
+
+func TestDispatcher_Backpressure(t *testing.T) {
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	d := NewDispatcher(1, 1, func(update tgbotapi.Update) {
+		started <- struct{}{}
+		<-release
+	})
+
+	d.Dispatch(messageUpdate(1, 1))
+	<-started                       // the worker holds the first update
+	d.Dispatch(messageUpdate(2, 1)) // fills the queue
+
+	dispatched := make(chan struct{})
+	go func() {
+		d.Dispatch(messageUpdate(3, 1))
+		close(dispatched)
+	}()
+
+	select {
+	case <-dispatched:
+		t.Fatal("expected Dispatch to block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if stats := d.Stats(); stats.Blocked != 1 || stats.Queued != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	close(release)
+	<-dispatched
+	d.Close()
+	if stats := d.Stats(); stats.Processed != 3 {
+		t.Errorf("expected 3 processed updates, got %+v", stats)
+	}
+}
+
+func TestServe_DrainsOnShutdown(t *testing.T) {
+	var mu sync.Mutex
+	handled := 0
+
+	handler := &BotHandler{}
+	handler.Dispatcher = NewDispatcher(2, 10, func(update tgbotapi.Update) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		handled++
+		mu.Unlock()
+	})
+
+	updates := make(chan tgbotapi.Update, 10)
+	for i := 0; i < 5; i++ {
+		updates <- messageUpdate(i, int64(i))
+	}
+	close(updates)
+
+	handler.Serve(context.Background(), updates, func() {})
+
+	mu.Lock()
+	if handled != 5 {
+		t.Errorf("expected queued updates to be handled before Serve returns, got %d", handled)
+	}
+	handled = 0
+	mu.Unlock()
+
+	// updates buffered when the context is done are still handled
+	handler.Dispatcher = NewDispatcher(2, 10, handler.Dispatcher.handle)
+	buffered := make(chan tgbotapi.Update, 10)
+	for i := 0; i < 3; i++ {
+		buffered <- messageUpdate(i, int64(i))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		handler.Serve(ctx, buffered, func() { close(buffered) })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Serve to return once the source is stopped")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if handled != 3 {
+		t.Errorf("expected buffered updates to be handled on shutdown, got %d", handled)
+	}
+}
@@ -1,130 +1,196 @@
 package bot
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"net/http"
-	"strconv"
+	"fmt"
 	"strings"
+	"url-shorter-bot/pkg/analytics"
+	"url-shorter-bot/pkg/app/service"
+	"url-shorter-bot/pkg/app/shortcode"
 	"url-shorter-bot/pkg/app/validators"
 	"url-shorter-bot/pkg/database"
 	"url-shorter-bot/pkg/logger"
+	"url-shorter-bot/pkg/metrics"
 	"url-shorter-bot/pkg/models"
+	"url-shorter-bot/pkg/users"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 type BotHandler struct {
-	Bot    models.TelegramBot
-	State  *StateStore
-	Db     database.SupabaseClient
-	Logger logger.Logger
+	Bot       models.TelegramBot
+	State     *StateStore
+	Db        database.SupabaseClient
+	Logger    logger.Logger
+	Stats     *analytics.Reporter
+	Shortener *service.ShortenerService
+	Links     *service.LinkService
+	Keys      *service.ApiKeyService
+	Users     users.IdentityResolver
+
+	Dispatcher *Dispatcher
 }
 
-func addUserToDb(telegramID int64, username string, h *BotHandler) {
-	_, err := h.Db.Insert("users_info", models.Users{
-		Telegram_id: telegramID,
-		Nick_Name:   username,
-	})
-	if err != nil {
-		_, secondErr := h.Db.Get("users_info", map[string]string{
-			"Telegram_id": strconv.FormatInt(telegramID, 10),
-		})
-
-		if secondErr != nil {
-			h.Logger.LogError(telegramID, err.Error(), "400")
-		}
-	}
-}
-
-func NewBotHandler(token string, state *StateStore, db database.SupabaseClient, log logger.Logger) (*BotHandler, error) {
+func NewBotHandler(token string, state *StateStore, db database.SupabaseClient, log logger.Logger, stats *analytics.Reporter, shortener *service.ShortenerService, links *service.LinkService, keys *service.ApiKeyService, users users.IdentityResolver) (*BotHandler, error) {
 	bot, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
 		return nil, err
 	}
-	return &BotHandler{Bot: bot, State: state, Db: db, Logger: log}, nil
+	return &BotHandler{Bot: bot, State: state, Db: db, Logger: log, Stats: stats, Shortener: shortener, Links: links, Keys: keys, Users: users}, nil
 }
 
-func (h *BotHandler) Run() {
+// pollTimeout is the long polling timeout in seconds. The last poll has to
+// return within the shutdown timeout for the updates channel to be closed.
+const pollTimeout = 10
+
+// Run receives updates by long polling until ctx is done.
+func (h *BotHandler) Run(ctx context.Context) error {
 	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates := h.Bot.GetUpdatesChan(u)
-
-	for update := range updates {
-		if update.Message != nil {
-			chatID := update.Message.Chat.ID
-			text := update.Message.Text
-			telegramID := update.Message.From.ID
-			username := update.Message.From.UserName
-
-			switch {
-			case text == "/start":
-				go addUserToDb(telegramID, username, h)
-
-				msg := tgbotapi.NewMessage(chatID, "👋 Welcome! Click the button below to shorten a URL.")
-				msg.ReplyMarkup = UrlShortenKeyboard()
-				h.Bot.Send(msg)
-
-			case text == "Shorten URL":
-				h.State.Set(chatID, "awaiting_url")
-				msg := tgbotapi.NewMessage(chatID, "Please send the URL you want to shorten.")
-				h.Bot.Send(msg)
-
-			case h.State.Get(chatID) == "awaiting_url":
-				h.State.Clear(chatID)
-				shortURL, err := h.shortenURL(text, telegramID)
-				if err != nil || shortURL == "" {
-					h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Failed to shorten URL."))
-					go h.Logger.LogError(telegramID, err.Error(), "400")
-					continue
-				}
-				if shortURL == "Too Many Request" {
-					msg := tgbotapi.NewMessage(chatID, shortURL)
-					h.Bot.Send(msg)
-				} else {
-					msg := tgbotapi.NewMessage(chatID, "✅ Shortened URL: "+shortURL)
-					h.Bot.Send(msg)
-				}
-
-			default:
-				msg := tgbotapi.NewMessage(chatID, "❓ I don't understand. Use the button or type /start.")
-				h.Bot.Send(msg)
+	u.Timeout = pollTimeout
+
+	h.Serve(ctx, h.Bot.GetUpdatesChan(u), h.Bot.StopReceivingUpdates)
+	return nil
+}
+
+// Serve handles updates until the channel is closed, whether they come from
+// long polling or the webhook. Once ctx is done it calls stop, which has to
+// close updates, and still handles what was buffered until then: Telegram
+// does not deliver those updates again. With a Dispatcher it returns once
+// the queued updates are handled.
+func (h *BotHandler) Serve(ctx context.Context, updates tgbotapi.UpdatesChannel, stop func()) {
+	handle := h.HandleUpdate
+	if h.Dispatcher != nil {
+		handle = h.Dispatcher.Dispatch
+		defer h.Dispatcher.Close()
+	}
+
+	done := ctx.Done()
+	for {
+		select {
+		case <-done:
+			stop()
+			done = nil
+		case update, ok := <-updates:
+			if !ok {
+				return
 			}
+			handle(update)
 		}
 	}
 }
 
-func (h *BotHandler) shortenURL(originalURL string, telegramID int64) (string, error) {
-	if !validators.IsValidURL(originalURL) {
-		return "", errors.New("Error to short url. Invalid url: " + originalURL)
+func (h *BotHandler) HandleUpdate(update tgbotapi.Update) {
+	metrics.BotUpdates.Inc(updateCommand(update))
+
+	switch {
+	case update.Message != nil:
+		h.handleMessage(update.Message)
+	case update.CallbackQuery != nil:
+		h.handleCallback(update.CallbackQuery)
 	}
+}
 
-	client := &http.Client{}
-	requestBody := strings.NewReader(`{"Url": "` + originalURL + `"}`)
+func (h *BotHandler) handleMessage(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	text := message.Text
+	telegramID := message.From.ID
+	username := message.From.UserName
+	state := h.State.Get(chatID)
 
-	req, _ := http.NewRequest("POST", "http://"+models.Config.HostName+":"+models.Config.Port+"/short", requestBody)
-	req.Header.Set("X-Telegram-ID", strconv.FormatInt(telegramID, 10))
-	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case text == "/start":
+		if _, err := h.Users.Register(telegramID, username); err != nil {
+			h.Logger.LogError(telegramID, err.Error(), "400")
+		}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+		msg := tgbotapi.NewMessage(chatID, "👋 Welcome! Click the button below to shorten a URL.")
+		msg.ReplyMarkup = UrlShortenKeyboard()
+		h.Bot.Send(msg)
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusTooManyRequests {
-		return "", err
+	case text == "/stats" || strings.HasPrefix(text, "/stats "):
+		h.handleStats(chatID, telegramID, strings.TrimSpace(strings.TrimPrefix(text, "/stats")))
+
+	case text == "/delete" || strings.HasPrefix(text, "/delete "):
+		h.handleDelete(chatID, telegramID, strings.TrimSpace(strings.TrimPrefix(text, "/delete")))
+
+	case text == "/edit" || strings.HasPrefix(text, "/edit "):
+		h.handleEdit(chatID, telegramID, strings.TrimSpace(strings.TrimPrefix(text, "/edit")))
+
+	case text == "/apikey" || strings.HasPrefix(text, "/apikey "):
+		h.handleApiKey(chatID, telegramID, strings.TrimSpace(strings.TrimPrefix(text, "/apikey")))
+
+	case text == "/list":
+		h.handleList(chatID, telegramID)
+
+	case text == "Shorten URL":
+		h.State.Set(chatID, "awaiting_url")
+		msg := tgbotapi.NewMessage(chatID, "Please send the URL you want to shorten.")
+		h.Bot.Send(msg)
+
+	case state == "awaiting_url":
+		if !validators.IsValidURL(text) {
+			h.State.Clear(chatID)
+			h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Failed to shorten URL."))
+			h.Logger.LogError(telegramID, "Error to short url. Invalid url: "+text, "400")
+			return
+		}
+
+		h.State.SetPending(chatID, text)
+		h.State.Set(chatID, "awaiting_code_choice")
+		msg := tgbotapi.NewMessage(chatID, "How should the short link look?")
+		msg.ReplyMarkup = CodeChoiceKeyboard()
+		h.Bot.Send(msg)
+
+	case state == "awaiting_new_url":
+		h.changeURL(chatID, telegramID, text)
+
+	case state == "awaiting_code_choice" && text == "Random code":
+		h.sendShortURL(chatID, telegramID, h.State.Pending(chatID), "")
+
+	case state == "awaiting_code_choice" && text == "Custom alias":
+		h.State.Set(chatID, "awaiting_alias")
+		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("Send the alias: %d-%d latin letters, digits, '-' or '_'.", validators.MinAliasLength, validators.MaxAliasLength))
+		h.Bot.Send(msg)
+
+	case state == "awaiting_alias":
+		if err := validators.ValidateAlias(text); err != nil {
+			h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Invalid alias: "+err.Error()+". Send another one."))
+			return
+		}
+		h.sendShortURL(chatID, telegramID, h.State.Pending(chatID), text)
+
+	default:
+		msg := tgbotapi.NewMessage(chatID, "❓ I don't understand. Use the button or type /start.")
+		h.Bot.Send(msg)
 	}
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return "Too Many Request", nil
+}
+
+// sendShortURL shortens originalURL and replies with the result. A taken
+// alias keeps the chat waiting for another alias.
+func (h *BotHandler) sendShortURL(chatID, telegramID int64, originalURL, alias string) {
+	link, err := h.Shortener.Shorten(telegramID, models.RequestData{Url: originalURL, Alias: alias})
+	if errors.Is(err, service.ErrAliasTaken) {
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ This alias is already taken. Send another one."))
+		return
 	}
 
-	result := models.Respons{}
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		return "", err
+	h.State.Clear(chatID)
+	switch {
+	case errors.Is(err, service.ErrQuotaExceeded):
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "⏳ You have reached your limit of new links. Try again later."))
+	case err != nil:
+		h.Logger.LogError(telegramID, err.Error(), "400")
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Failed to shorten URL."))
+	default:
+		h.Logger.LogAction(telegramID, "shortened link")
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "✅ Shortened URL: "+shortcode.Link(link.Hash)))
 	}
+}
 
-	return result.Url, nil
+// send delivers c and logs a failure, e.g. a message over the Telegram limit.
+func (h *BotHandler) send(telegramID int64, c tgbotapi.Chattable) {
+	if _, err := h.Bot.Send(c); err != nil {
+		h.Logger.LogError(telegramID, "failed to send a message: "+err.Error(), "500")
+	}
 }
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const listPageSize = 5
+
+// Callback data prefixes of the /list inline keyboard. Short codes never
+// contain ':' so the code is always the last field.
+const (
+	callbackList    = "list"
+	callbackStats   = "stats"
+	callbackDelete  = "delete"
+	callbackDisable = "disable"
+	callbackEnable  = "enable"
+	callbackEdit    = "edit"
+	callbackCopy    = "copy"
+)
+
+// handleList answers "/list" with the first page of the caller's links.
+func (h *BotHandler) handleList(chatID, telegramID int64) {
+	text, markup, err := h.listPage(telegramID, 0)
+	if err != nil {
+		h.Logger.LogError(telegramID, err.Error(), "500")
+		h.send(telegramID, tgbotapi.NewMessage(chatID, "❌ Failed to load your links."))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	if markup != nil {
+		msg.ReplyMarkup = *markup
+	}
+	h.send(telegramID, msg)
+}
+
+// handleCallback dispatches the buttons of the /list keyboard.
+func (h *BotHandler) handleCallback(query *tgbotapi.CallbackQuery) {
+	if query.Message == nil {
+		h.Bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	chatID := query.Message.Chat.ID
+	messageID := query.Message.MessageID
+	telegramID := query.From.ID
+	action, arg, _ := strings.Cut(query.Data, ":")
+
+	switch action {
+	case callbackList:
+		h.Bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		if page, err := strconv.Atoi(arg); err == nil && page >= 0 {
+			h.editListPage(chatID, messageID, telegramID, page)
+		}
+
+	case callbackStats:
+		h.Bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		h.handleStats(chatID, telegramID, arg)
+
+	case callbackEdit:
+		h.Bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		h.handleEdit(chatID, telegramID, arg)
+
+	case callbackCopy:
+		h.Bot.Request(tgbotapi.NewCallback(query.ID, ""))
+		h.send(telegramID, tgbotapi.NewMessage(chatID, shortcode.Link(arg)))
+
+	case callbackDelete, callbackDisable, callbackEnable:
+		pageArg, code, _ := strings.Cut(arg, ":")
+		page, _ := strconv.Atoi(pageArg)
+
+		answer, err := h.changeLink(telegramID, action, code)
+		h.Bot.Request(tgbotapi.NewCallback(query.ID, answer))
+		if err == nil {
+			h.editListPage(chatID, messageID, telegramID, page)
+		}
+
+	default:
+		h.Bot.Request(tgbotapi.NewCallback(query.ID, ""))
+	}
+}
+
+// editListPage replaces the /list message with another page. A page that
+// became empty after a delete falls back to the previous one.
+func (h *BotHandler) editListPage(chatID int64, messageID int, telegramID int64, page int) {
+	text, markup, err := h.listPage(telegramID, page)
+	for err == nil && markup == nil && page > 0 {
+		page--
+		text, markup, err = h.listPage(telegramID, page)
+	}
+	if err != nil {
+		h.Logger.LogError(telegramID, err.Error(), "500")
+		text, markup = "❌ Failed to load your links.", nil
+	}
+
+	if markup == nil {
+		h.send(telegramID, tgbotapi.NewEditMessageText(chatID, messageID, text))
+		return
+	}
+	h.send(telegramID, tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, *markup))
+}
+
+// listPage renders one page of the caller's links, newest first. The markup
+// is nil when the page has no links.
+func (h *BotHandler) listPage(telegramID int64, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	query := fmt.Sprintf("Telegram_id=eq.%d&order=created_at.desc&limit=%d&offset=%d", telegramID, listPageSize+1, page*listPageSize)
+
+	body, err := h.Db.Select("urls", query)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var links []models.Url
+	if err := json.Unmarshal(body, &links); err != nil {
+		return "", nil, err
+	}
+	if len(links) == 0 {
+		return "You have no short links yet.", nil, nil
+	}
+
+	hasNext := len(links) > listPageSize
+	if hasNext {
+		links = links[:listPageSize]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🔗 Your links (page %d):\n", page+1)
+
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	for i, link := range links {
+		n := page*listPageSize + i + 1
+		fmt.Fprintf(&b, "\n%d. %s → %s", n, shortcode.Link(link.Hash), listedURL(link.Url))
+
+		toggle := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⏸ %d", n), fmt.Sprintf("%s:%d:%s", callbackDisable, page, link.Hash))
+		if link.Disabled {
+			b.WriteString(" (disabled)")
+			toggle = tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("▶️ %d", n), fmt.Sprintf("%s:%d:%s", callbackEnable, page, link.Hash))
+		}
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("📊 %d", n), callbackStats+":"+link.Hash),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑 %d", n), fmt.Sprintf("%s:%d:%s", callbackDelete, page, link.Hash)),
+			toggle,
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("✏️ %d", n), callbackEdit+":"+link.Hash),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("📋 %d", n), callbackCopy+":"+link.Hash),
+		))
+	}
+
+	nav := []tgbotapi.InlineKeyboardButton{}
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("⬅️ Prev", fmt.Sprintf("%s:%d", callbackList, page-1)))
+	}
+	if hasNext {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("Next ➡️", fmt.Sprintf("%s:%d", callbackList, page+1)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return b.String(), &markup, nil
+}
@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"errors"
+	"url-shorter-bot/pkg/app/service"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleDelete answers "/delete <code>".
+func (h *BotHandler) handleDelete(chatID, telegramID int64, code string) {
+	if code == "" {
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "Send /delete <code>, or use the buttons of /list."))
+		return
+	}
+
+	code = shortcode.Normalize(code, models.Config.CodeCaseInsensitive)
+	reply, _ := h.changeLink(telegramID, callbackDelete, code)
+	h.Bot.Send(tgbotapi.NewMessage(chatID, reply))
+}
+
+// changeLink deletes, disables or enables a link of telegramID and returns
+// the text to show to the user.
+func (h *BotHandler) changeLink(telegramID int64, action, code string) (string, error) {
+	var err error
+	var done string
+
+	switch action {
+	case callbackDelete:
+		err, done = h.Links.Delete(telegramID, code), "🗑 Deleted "
+	case callbackDisable:
+		err, done = h.Links.SetDisabled(telegramID, code, true), "⏸ Disabled "
+	case callbackEnable:
+		err, done = h.Links.SetDisabled(telegramID, code, false), "▶️ Enabled "
+	default:
+		return "", errors.New("unknown action: " + action)
+	}
+
+	if errors.Is(err, service.ErrLinkNotFound) {
+		return "❌ Link not found.", err
+	}
+	if err != nil {
+		h.Logger.LogError(telegramID, err.Error(), "500")
+		return "❌ Failed to " + action + " the link.", err
+	}
+
+	h.Logger.LogAction(telegramID, action+" link "+code)
+	return done + code, nil
+}
+
+// handleEdit answers "/edit <code>" by asking for the new destination.
+func (h *BotHandler) handleEdit(chatID, telegramID int64, code string) {
+	if code == "" {
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "Send /edit <code>, or use the buttons of /list."))
+		return
+	}
+
+	code = shortcode.Normalize(code, models.Config.CodeCaseInsensitive)
+	if _, err := h.Links.Owned(telegramID, code); err != nil {
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Link not found."))
+		return
+	}
+
+	h.State.SetPending(chatID, code)
+	h.State.Set(chatID, "awaiting_new_url")
+	h.Bot.Send(tgbotapi.NewMessage(chatID, "Send the new destination URL for "+shortcode.Link(code)+"."))
+}
+
+// changeURL points the link picked by handleEdit at newURL. An invalid URL
+// keeps the chat waiting for another one.
+func (h *BotHandler) changeURL(chatID, telegramID int64, newURL string) {
+	code := h.State.Pending(chatID)
+
+	link, err := h.Links.ChangeURL(telegramID, code, newURL)
+	if errors.Is(err, service.ErrInvalidURL) {
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Invalid URL. Send another one."))
+		return
+	}
+
+	h.State.Clear(chatID)
+	switch {
+	case errors.Is(err, service.ErrLinkNotFound):
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Link not found."))
+	case err != nil:
+		h.Logger.LogError(telegramID, err.Error(), "500")
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "❌ Failed to update the link."))
+	default:
+		h.Logger.LogAction(telegramID, "changed url of link "+code)
+		h.Bot.Send(tgbotapi.NewMessage(chatID, "✏️ "+shortcode.Link(code)+" now points to "+link.Url))
+	}
+}
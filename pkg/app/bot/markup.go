@@ -13,3 +13,15 @@ func UrlShortenKeyboard() tgbotapi.ReplyKeyboardMarkup {
 	keyboard.ResizeKeyboard = true
 	return keyboard
 }
+
+func CodeChoiceKeyboard() tgbotapi.ReplyKeyboardMarkup {
+	keyboard := tgbotapi.NewReplyKeyboard(
+		[]tgbotapi.KeyboardButton{
+			tgbotapi.NewKeyboardButton("Random code"),
+			tgbotapi.NewKeyboardButton("Custom alias"),
+		},
+	)
+	keyboard.OneTimeKeyboard = true
+	keyboard.ResizeKeyboard = true
+	return keyboard
+}
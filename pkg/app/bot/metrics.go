@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commands are the label values of the bot updates metric. Everything else
+// is counted as "message" or "callback_other", so users cannot create
+// series.
+var commands = map[string]bool{
+	"/start": true, "/stats": true, "/delete": true, "/edit": true, "/apikey": true, "/list": true,
+	"Shorten URL": true, "Random code": true, "Custom alias": true,
+}
+
+var callbacks = map[string]bool{
+	callbackList: true, callbackStats: true, callbackDelete: true, callbackDisable: true,
+	callbackEnable: true, callbackEdit: true, callbackCopy: true,
+}
+
+// updateCommand names the command of an update for the metrics.
+func updateCommand(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil:
+		text := update.Message.Text
+		if command, _, _ := strings.Cut(text, " "); strings.HasPrefix(command, "/") {
+			text = command
+		}
+		if commands[text] {
+			return text
+		}
+		return "message"
+	case update.CallbackQuery != nil:
+		action, _, _ := strings.Cut(update.CallbackQuery.Data, ":")
+		if callbacks[action] {
+			return "callback_" + action
+		}
+		return "callback_other"
+	}
+	return "other"
+}
@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestUpdateCommand(t *testing.T) {
+	message := func(text string) tgbotapi.Update {
+		return tgbotapi.Update{Message: &tgbotapi.Message{Text: text}}
+	}
+	callback := func(data string) tgbotapi.Update {
+		return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: data}}
+	}
+
+	tests := []struct {
+		name     string
+		update   tgbotapi.Update
+		expected string
+	}{
+		{name: "command", update: message("/start"), expected: "/start"},
+		{name: "command with argument", update: message("/stats abc123"), expected: "/stats"},
+		{name: "button", update: message("Shorten URL"), expected: "Shorten URL"},
+		{name: "unknown command", update: message("/whatever"), expected: "message"},
+		{name: "plain text", update: message("https://example.com"), expected: "message"},
+		{name: "callback", update: callback("delete:0:abc123"), expected: "callback_delete"},
+		{name: "unknown callback", update: callback("random"), expected: "callback_other"},
+		{name: "other update", update: tgbotapi.Update{}, expected: "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := updateCommand(tt.update); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -3,12 +3,13 @@ package bot
 import "sync"
 
 type StateStore struct {
-	mu     sync.RWMutex
-	states map[int64]string
+	mu      sync.RWMutex
+	states  map[int64]string
+	pending map[int64]string
 }
 
 func NewStateStore() *StateStore {
-	return &StateStore{states: make(map[int64]string)}
+	return &StateStore{states: make(map[int64]string), pending: make(map[int64]string)}
 }
 
 func (s *StateStore) Set(chatID int64, state string) {
@@ -23,6 +24,23 @@ func (s *StateStore) Get(chatID int64) string {
 	return s.states[chatID]
 }
 
+// SetPending remembers what a multi-step flow works on: the URL being
+// shortened while the chat picks a code, or the code whose URL is edited.
+func (s *StateStore) SetPending(chatID int64, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[chatID] = value
+}
+
+func (s *StateStore) Pending(chatID int64) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pending[chatID]
+}
+
 func (s *StateStore) Clear(chatID int64) {
-	s.Set(chatID, "")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[chatID] = ""
+	delete(s.pending, chatID)
 }
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/models"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	statsDays      = 30
+	statsLinks     = 20
+	statsReferrers = 5
+	statsCountries = 5
+)
+
+// maxListedURL is how many runes of a destination the link lists show, so
+// that a page of long URLs stays within the Telegram message limit.
+const maxListedURL = 60
+
+// handleStats answers "/stats" with the caller's links and "/stats <code>"
+// with the report of a single link.
+func (h *BotHandler) handleStats(chatID, telegramID int64, code string) {
+	if code == "" {
+		h.send(telegramID, tgbotapi.NewMessage(chatID, h.linksReport(telegramID)))
+		return
+	}
+
+	code = shortcode.Normalize(code, models.Config.CodeCaseInsensitive)
+	if _, err := h.Links.Owned(telegramID, code); err != nil {
+		h.send(telegramID, tgbotapi.NewMessage(chatID, "❌ Link not found."))
+		return
+	}
+
+	stats, err := h.Stats.LinkStats(code, statsDays)
+	if err != nil {
+		h.Logger.LogError(telegramID, err.Error(), "500")
+		h.send(telegramID, tgbotapi.NewMessage(chatID, "❌ Failed to load stats."))
+		return
+	}
+
+	h.send(telegramID, tgbotapi.NewMessage(chatID, linkReport(stats)))
+}
+
+func (h *BotHandler) linksReport(telegramID int64) string {
+	body, err := h.Db.Select("urls", "Telegram_id=eq."+strconv.FormatInt(telegramID, 10)+"&order=created_at.desc&limit="+strconv.Itoa(statsLinks))
+	if err != nil {
+		h.Logger.LogError(telegramID, err.Error(), "500")
+		return "❌ Failed to load your links."
+	}
+
+	var links []models.Url
+	if err := json.Unmarshal(body, &links); err != nil || len(links) == 0 {
+		return "You have no short links yet."
+	}
+
+	hashes := make([]string, len(links))
+	for i, link := range links {
+		hashes[i] = link.Hash
+	}
+	counts, err := h.Stats.ClickCounts(hashes)
+	if err != nil {
+		h.Logger.LogError(telegramID, err.Error(), "500")
+		return "❌ Failed to load your links."
+	}
+
+	var b strings.Builder
+	b.WriteString("📊 Your links:\n")
+	for i, link := range links {
+		fmt.Fprintf(&b, "\n%d. %s → %s\n   %d clicks", i+1, shortcode.Link(link.Hash), listedURL(link.Url), counts[link.Hash])
+	}
+	b.WriteString("\n\nSend /stats <code> for details.")
+	return b.String()
+}
+
+// listedURL cuts u to maxListedURL runes.
+func listedURL(u string) string {
+	runes := []rune(u)
+	if len(runes) <= maxListedURL {
+		return u
+	}
+	return string(runes[:maxListedURL-1]) + "…"
+}
+
+func linkReport(stats models.LinkStats) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 %s\n\n", shortcode.Link(stats.Hash))
+	fmt.Fprintf(&b, "Clicks in the last %d days: %d\n", statsDays, stats.TotalClicks)
+	fmt.Fprintf(&b, "Unique visitors: %d\n", stats.UniqueVisitors)
+
+	if stats.LastClick != nil {
+		fmt.Fprintf(&b, "Last click: %s\n", stats.LastClick.UTC().Format("2006-01-02 15:04 UTC"))
+	} else {
+		b.WriteString("Last click: never\n")
+	}
+
+	if stats.TotalClicks == 0 {
+		return b.String()
+	}
+
+	b.WriteString("\nPer day:\n")
+	for _, day := range stats.PerDay {
+		if day.Clicks > 0 {
+			fmt.Fprintf(&b, "%s: %d\n", day.Day, day.Clicks)
+		}
+	}
+
+	b.WriteString("\nTop referrers:\n")
+	for i, referrer := range stats.Referrers {
+		if i == statsReferrers {
+			break
+		}
+		fmt.Fprintf(&b, "%s: %d\n", referrer.Referrer, referrer.Clicks)
+	}
+
+	if len(stats.Countries) == 0 {
+		return b.String()
+	}
+	b.WriteString("\nTop countries:\n")
+	for i, country := range stats.Countries {
+		if i == statsCountries {
+			break
+		}
+		fmt.Fprintf(&b, "%s: %d\n", country.Country, country.Clicks)
+	}
+	return b.String()
+}
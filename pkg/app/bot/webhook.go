@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// WebhookSecretHeader carries the secret_token given to setWebhook.
+const WebhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// WebhookPath is the route Telegram posts updates to. It is derived from the
+// bot token, so it is stable across restarts but not guessable.
+func WebhookPath(token string) string {
+	sum := sha256.Sum256([]byte("webhook:" + token))
+	return "/telegram/" + hex.EncodeToString(sum[:16])
+}
+
+// SetWebhook makes Telegram deliver updates to link instead of long polling.
+// The library's WebhookConfig has no secret_token, so the method is called
+// directly.
+func (h *BotHandler) SetWebhook(link, secret string) error {
+	resp, err := h.Bot.MakeRequest("setWebhook", tgbotapi.Params{
+		"url":             link,
+		"secret_token":    secret,
+		"allowed_updates": `["message","callback_query"]`,
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return errors.New("setWebhook: " + resp.Description)
+	}
+	return nil
+}
+
+// DeleteWebhook switches the bot back to long polling.
+func (h *BotHandler) DeleteWebhook() error {
+	_, err := h.Bot.Request(tgbotapi.DeleteWebhookConfig{})
+	return err
+}
+
+// WebhookHandler accepts updates posted by Telegram and passes them to
+// updates. Requests without secret in WebhookSecretHeader are rejected.
+func WebhookHandler(secret string, updates chan<- tgbotapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "must be only POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(WebhookSecretHeader)), []byte(secret)) != 1 {
+			http.Error(w, "invalid secret token", http.StatusForbidden)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			// Telegram delivers the update again later
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		secret         string
+		body           string
+		expectedStatus int
+		expectUpdate   bool
+	}{
+		{name: "valid update", method: http.MethodPost, secret: "s3cret", body: `{"update_id": 7, "message": {"text": "/start"}}`, expectedStatus: http.StatusOK, expectUpdate: true},
+		{name: "wrong secret", method: http.MethodPost, secret: "guess", body: `{"update_id": 7}`, expectedStatus: http.StatusForbidden},
+		{name: "missing secret", method: http.MethodPost, body: `{"update_id": 7}`, expectedStatus: http.StatusForbidden},
+		{name: "invalid JSON", method: http.MethodPost, secret: "s3cret", body: `{`, expectedStatus: http.StatusBadRequest},
+		{name: "GET", method: http.MethodGet, secret: "s3cret", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates := make(chan tgbotapi.Update, 1)
+			req := httptest.NewRequest(tt.method, "/telegram/hook", bytes.NewBufferString(tt.body))
+			if tt.secret != "" {
+				req.Header.Set(WebhookSecretHeader, tt.secret)
+			}
+			w := httptest.NewRecorder()
+
+			WebhookHandler("s3cret", updates).ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			select {
+			case update := <-updates:
+				if !tt.expectUpdate {
+					t.Errorf("unexpected update %+v", update)
+				} else if update.UpdateID != 7 || update.Message == nil || update.Message.Text != "/start" {
+					t.Errorf("unexpected update %+v", update)
+				}
+			default:
+				if tt.expectUpdate {
+					t.Error("expected an update to be queued")
+				}
+			}
+		})
+	}
+}
+
+func TestSetWebhook(t *testing.T) {
+	mockBot := &mockBotAPI{}
+	handler := &BotHandler{Bot: mockBot}
+
+	path := WebhookPath("123:token")
+	if !strings.HasPrefix(path, "/telegram/") || strings.Contains(path, "token") || path != WebhookPath("123:token") {
+		t.Errorf("unexpected webhook path %q", path)
+	}
+
+	if err := handler.SetWebhook("https://short.ly"+path, "s3cret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mockBot.endpoints) != 1 || mockBot.endpoints[0] != "setWebhook" {
+		t.Fatalf("expected setWebhook to be called, got %v", mockBot.endpoints)
+	}
+	params := mockBot.params[0]
+	if params["url"] != "https://short.ly"+path || params["secret_token"] != "s3cret" {
+		t.Errorf("unexpected setWebhook params %v", params)
+	}
+
+	if err := handler.DeleteWebhook(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := mockBot.requests[0].(tgbotapi.DeleteWebhookConfig); !ok {
+		t.Errorf("expected deleteWebhook, got %T", mockBot.requests[0])
+	}
+}
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"url-shorter-bot/pkg/analytics"
+	"url-shorter-bot/pkg/app/service"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/logger"
+	"url-shorter-bot/pkg/middleware"
+	"url-shorter-bot/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	maxBulkLinks    = 100
+)
+
+// apiError is the JSON error body of every /api/v1 response.
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newApiError(status int, code, message string) *apiError {
+	return &apiError{Status: status, Code: code, Message: message}
+}
+
+// apiLink is how /api/v1 shows a link.
+type apiLink struct {
+	Code      string     `json:"code"`
+	ShortUrl  string     `json:"short_url"`
+	Url       string     `json:"url"`
+	Disabled  bool       `json:"disabled"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func toApiLink(link models.Url) apiLink {
+	return apiLink{
+		Code:      link.Hash,
+		ShortUrl:  shortcode.Link(link.Hash),
+		Url:       link.Url,
+		Disabled:  link.Disabled,
+		ExpiresAt: link.Expires_at,
+	}
+}
+
+type linkList struct {
+	Links  []apiLink `json:"links"`
+	Total  int       `json:"total"`
+	Limit  int       `json:"limit"`
+	Offset int       `json:"offset"`
+}
+
+type bulkRequest struct {
+	Links []models.RequestData `json:"links"`
+}
+
+type bulkResult struct {
+	Status int       `json:"status"`
+	Link   *apiLink  `json:"link,omitempty"`
+	Error  *apiError `json:"error,omitempty"`
+}
+
+type updateRequest struct {
+	Url      *string `json:"url"`
+	Disabled *bool   `json:"disabled"`
+}
+
+type ApiV1Handler struct {
+	db        database.SupabaseClient
+	shortener *service.ShortenerService
+	links     *service.LinkService
+	reporter  *analytics.Reporter
+	logger    logger.Logger
+}
+
+func NewApiV1Handler(db database.SupabaseClient, shortener *service.ShortenerService, links *service.LinkService, reporter *analytics.Reporter, log logger.Logger) *ApiV1Handler {
+	return &ApiV1Handler{db: db, shortener: shortener, links: links, reporter: reporter, logger: log}
+}
+
+// RegisterRoutes mounts the API on r under /api/v1. Everything except the
+// OpenAPI document goes through authenticated, creating links also goes
+// through create.
+func (h *ApiV1Handler) RegisterRoutes(r *mux.Router, authenticated, create func(http.Handler) http.Handler) {
+	api := r.PathPrefix("/api/v1").Subrouter()
+	// rejections of the authentication and the rate limits are JSON too
+	api.Use(middleware.ErrorWriterMiddleware(func(w http.ResponseWriter, status int, code, message string) {
+		writeApiError(w, newApiError(status, code, message))
+	}))
+
+	api.HandleFunc("/openapi.json", h.HandlerOpenAPI)
+	// POST only, so a link with the alias "bulk" stays reachable below
+	api.Handle("/links/bulk", authenticated(create(http.HandlerFunc(h.HandlerBulkLinks)))).Methods(http.MethodPost)
+	api.Handle("/links", authenticated(create(http.HandlerFunc(h.HandlerLinks)))).Methods(http.MethodPost)
+	api.Handle("/links", authenticated(http.HandlerFunc(h.HandlerLinks)))
+	api.Handle("/links/{code}", authenticated(http.HandlerFunc(h.HandlerLink)))
+	api.Handle("/links/{code}/stats", authenticated(http.HandlerFunc(h.HandlerLinkStats)))
+}
+
+// HandlerOpenAPI serves the OpenAPI document of /api/v1.
+func (h *ApiV1Handler) HandlerOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeApiError(w, methodNotAllowed(w, http.MethodGet))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPIDocument)
+}
+
+// HandlerLinks lists (GET) and creates (POST) the links of the caller.
+func (h *ApiV1Handler) HandlerLinks(w http.ResponseWriter, r *http.Request) {
+	telegramID, ok := apiTelegramID(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := h.list(telegramID, r.URL.Query())
+		if err != nil {
+			writeApiError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+
+	case http.MethodPost:
+		var req models.RequestData
+		if err := decodeJSON(r, &req); err != nil {
+			writeApiError(w, err)
+			return
+		}
+
+		link, err := h.create(telegramID, req)
+		if err != nil {
+			writeApiError(w, err)
+			return
+		}
+		w.Header().Set("Location", "/api/v1/links/"+url.PathEscape(link.Code))
+		writeJSON(w, http.StatusCreated, link)
+
+	default:
+		writeApiError(w, methodNotAllowed(w, http.MethodGet, http.MethodPost))
+	}
+}
+
+// HandlerBulkLinks creates up to maxBulkLinks links at once. Every link gets
+// its own status, so one bad URL does not fail the whole batch.
+func (h *ApiV1Handler) HandlerBulkLinks(w http.ResponseWriter, r *http.Request) {
+	telegramID, ok := apiTelegramID(w, r)
+	if !ok {
+		return
+	}
+
+	var req bulkRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeApiError(w, err)
+		return
+	}
+	if len(req.Links) == 0 || len(req.Links) > maxBulkLinks {
+		writeApiError(w, newApiError(http.StatusBadRequest, "invalid_request", fmt.Sprintf("links must contain 1 to %d items", maxBulkLinks)))
+		return
+	}
+
+	results := make([]bulkResult, len(req.Links))
+	for i, item := range req.Links {
+		link, err := h.create(telegramID, item)
+		if err != nil {
+			results[i] = bulkResult{Status: err.Status, Error: err}
+			continue
+		}
+		results[i] = bulkResult{Status: http.StatusCreated, Link: &link}
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]bulkResult{"results": results})
+}
+
+// HandlerLink reads (GET), updates (PATCH) and deletes (DELETE) a link of
+// the caller.
+func (h *ApiV1Handler) HandlerLink(w http.ResponseWriter, r *http.Request) {
+	telegramID, ok := apiTelegramID(w, r)
+	if !ok {
+		return
+	}
+
+	code := shortcode.Normalize(mux.Vars(r)["code"], models.Config.CodeCaseInsensitive)
+
+	switch r.Method {
+	case http.MethodGet:
+		link, err := h.links.Owned(telegramID, code)
+		if err != nil {
+			writeApiError(w, h.serviceError(telegramID, err))
+			return
+		}
+		writeJSON(w, http.StatusOK, toApiLink(link))
+
+	case http.MethodPatch:
+		var req updateRequest
+		if err := decodeJSON(r, &req); err != nil {
+			writeApiError(w, err)
+			return
+		}
+		if req.Url == nil && req.Disabled == nil {
+			writeApiError(w, newApiError(http.StatusBadRequest, "invalid_request", "nothing to update, send url and/or disabled"))
+			return
+		}
+
+		if req.Url != nil {
+			if _, err := h.links.ChangeURL(telegramID, code, *req.Url); err != nil {
+				writeApiError(w, h.serviceError(telegramID, err))
+				return
+			}
+		}
+		if req.Disabled != nil {
+			if err := h.links.SetDisabled(telegramID, code, *req.Disabled); err != nil {
+				writeApiError(w, h.serviceError(telegramID, err))
+				return
+			}
+		}
+
+		link, err := h.links.Owned(telegramID, code)
+		if err != nil {
+			writeApiError(w, h.serviceError(telegramID, err))
+			return
+		}
+		h.logger.LogAction(telegramID, "updated link "+code)
+		writeJSON(w, http.StatusOK, toApiLink(link))
+
+	case http.MethodDelete:
+		if err := h.links.Delete(telegramID, code); err != nil {
+			writeApiError(w, h.serviceError(telegramID, err))
+			return
+		}
+		h.logger.LogAction(telegramID, "deleted link "+code)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeApiError(w, methodNotAllowed(w, http.MethodGet, http.MethodPatch, http.MethodDelete))
+	}
+}
+
+// HandlerLinkStats returns the click statistics of a link of the caller.
+func (h *ApiV1Handler) HandlerLinkStats(w http.ResponseWriter, r *http.Request) {
+	telegramID, ok := apiTelegramID(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeApiError(w, methodNotAllowed(w, http.MethodGet))
+		return
+	}
+
+	code := shortcode.Normalize(mux.Vars(r)["code"], models.Config.CodeCaseInsensitive)
+
+	days := defaultStatsDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 365 {
+			writeApiError(w, newApiError(http.StatusBadRequest, "invalid_days", "days must be between 1 and 365"))
+			return
+		}
+		days = n
+	}
+
+	if _, err := h.links.Owned(telegramID, code); err != nil {
+		writeApiError(w, h.serviceError(telegramID, err))
+		return
+	}
+
+	stats, err := h.reporter.LinkStats(code, days)
+	if err != nil {
+		writeApiError(w, h.serviceError(telegramID, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *ApiV1Handler) create(telegramID int64, req models.RequestData) (apiLink, *apiError) {
+	link, err := h.shortener.Shorten(telegramID, req)
+	if err != nil {
+		return apiLink{}, h.serviceError(telegramID, err)
+	}
+
+	h.logger.LogAction(telegramID, "shortened link")
+	return toApiLink(link), nil
+}
+
+// list reads a page of links. Supported filters: status (active, disabled
+// or expired) and q, a case-insensitive part of the destination URL.
+func (h *ApiV1Handler) list(telegramID int64, query url.Values) (linkList, *apiError) {
+	limit, offset := defaultPageSize, 0
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPageSize {
+			return linkList{}, newApiError(http.StatusBadRequest, "invalid_limit", fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		}
+		limit = n
+	}
+	if value := query.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return linkList{}, newApiError(http.StatusBadRequest, "invalid_offset", "offset must not be negative")
+		}
+		offset = n
+	}
+
+	filter := "Telegram_id=eq." + strconv.FormatInt(telegramID, 10)
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	switch query.Get("status") {
+	case "":
+	case "active":
+		filter += "&Disabled=is.false&or=(Expires_at.is.null,Expires_at.gt." + now + ")"
+	case "disabled":
+		filter += "&Disabled=is.true"
+	case "expired":
+		filter += "&Expires_at=lt." + now
+	default:
+		return linkList{}, newApiError(http.StatusBadRequest, "invalid_status", "status must be active, disabled or expired")
+	}
+
+	if q := query.Get("q"); q != "" {
+		if strings.ContainsAny(q, "*,()") {
+			return linkList{}, newApiError(http.StatusBadRequest, "invalid_query", "q must not contain * , ( or )")
+		}
+		filter += "&Url=ilike." + url.QueryEscape("*"+q+"*")
+	}
+
+	total, err := h.db.Count("urls", filter)
+	if err != nil {
+		return linkList{}, h.serviceError(telegramID, err)
+	}
+
+	body, err := h.db.Select("urls", fmt.Sprintf("%s&order=created_at.desc&limit=%d&offset=%d", filter, limit, offset))
+	if err != nil {
+		return linkList{}, h.serviceError(telegramID, err)
+	}
+
+	var links []models.Url
+	if err := json.Unmarshal(body, &links); err != nil {
+		return linkList{}, h.serviceError(telegramID, err)
+	}
+
+	list := linkList{Links: []apiLink{}, Total: total, Limit: limit, Offset: offset}
+	for _, link := range links {
+		list.Links = append(list.Links, toApiLink(link))
+	}
+	return list, nil
+}
+
+// serviceError maps errors of the services to API errors, logging the
+// unexpected ones.
+func (h *ApiV1Handler) serviceError(telegramID int64, err error) *apiError {
+	switch {
+	case errors.Is(err, service.ErrLinkNotFound):
+		return newApiError(http.StatusNotFound, "not_found", "link not found")
+	case errors.Is(err, service.ErrInvalidURL):
+		return newApiError(http.StatusBadRequest, "invalid_url", "invalid URL")
+	case errors.Is(err, service.ErrInvalidLifeTime):
+		return newApiError(http.StatusBadRequest, "invalid_life_time", "invalid life_time")
+	case errors.Is(err, service.ErrInvalidAlias):
+		return newApiError(http.StatusBadRequest, "invalid_alias", err.Error())
+	case errors.Is(err, service.ErrAliasTaken):
+		return newApiError(http.StatusConflict, "alias_taken", "alias is already taken")
+	case errors.Is(err, service.ErrQuotaExceeded):
+		return newApiError(http.StatusTooManyRequests, "quota_exceeded", err.Error())
+	default:
+		h.logger.LogError(telegramID, err.Error(), "500")
+		return newApiError(http.StatusInternalServerError, "internal_error", "internal error")
+	}
+}
+
+func apiTelegramID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	telegramID, ok := r.Context().Value(middleware.TelegramIDKey).(int64)
+	if !ok {
+		writeApiError(w, newApiError(http.StatusUnauthorized, "unauthorized", "missing credentials"))
+	}
+	return telegramID, ok
+}
+
+func decodeJSON(r *http.Request, v interface{}) *apiError {
+	if r.Header.Get("Content-Type") != "application/json" {
+		return newApiError(http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/json")
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return newApiError(http.StatusBadRequest, "invalid_json", "invalid JSON body")
+	}
+	return nil
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) *apiError {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	return newApiError(http.StatusMethodNotAllowed, "method_not_allowed", "method must be one of "+strings.Join(allowed, ", "))
+}
+
+func writeApiError(w http.ResponseWriter, err *apiError) {
+	writeJSON(w, err.Status, map[string]*apiError{"error": err})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"url-shorter-bot/pkg/analytics"
+	"url-shorter-bot/pkg/app/service"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/cache"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/middleware"
+	"url-shorter-bot/pkg/models"
+	"url-shorter-bot/pkg/users"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestApi(t *testing.T) (http.Handler, database.SupabaseClient) {
+	t.Helper()
+	db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "api.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	generator, err := shortcode.NewGenerator("random", shortcode.DefaultAlphabet, shortcode.DefaultLength)
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+
+	log := &mockLogger{}
+	links := service.NewLinkService(db, &mockCache{data: map[string]string{}})
+	api := NewApiV1Handler(db, service.NewShortenerService(db, generator, service.Quota{}, users.NewResolver(db, cache.NewMemoryCache(time.Minute, time.Minute))), links, analytics.NewReporter(db), log)
+
+	r := mux.NewRouter()
+	api.RegisterRoutes(r, middleware.TelegramIDMiddleware, func(next http.Handler) http.Handler { return next })
+	return r, db
+}
+
+func TestApiV1(t *testing.T) {
+	steps := []struct {
+		name           string
+		method         string
+		path           string
+		telegramID     string
+		body           string
+		expectedStatus int
+		expectedBody   []string
+	}{
+		{name: "openapi without credentials", method: http.MethodGet, path: "/api/v1/openapi.json", expectedStatus: http.StatusOK, expectedBody: []string{`"openapi": "3.0.3"`}},
+		{name: "create", method: http.MethodPost, path: "/api/v1/links", body: `{"url": "https://example.com/one", "alias": "first"}`, expectedStatus: http.StatusCreated, expectedBody: []string{`"code":"first"`, `"short_url":"http://localhost/first"`}},
+		{name: "create with invalid url", method: http.MethodPost, path: "/api/v1/links", body: `{"url": "example"}`, expectedStatus: http.StatusBadRequest, expectedBody: []string{`"code":"invalid_url"`}},
+		{name: "create with taken alias", method: http.MethodPost, path: "/api/v1/links", body: `{"url": "https://example.com/two", "alias": "first"}`, expectedStatus: http.StatusConflict, expectedBody: []string{`"code":"alias_taken"`}},
+		{name: "create with invalid JSON", method: http.MethodPost, path: "/api/v1/links", body: `{`, expectedStatus: http.StatusBadRequest, expectedBody: []string{`"code":"invalid_json"`}},
+		{
+			name:           "bulk create",
+			method:         http.MethodPost,
+			path:           "/api/v1/links/bulk",
+			body:           `{"links": [{"url": "https://example.com/two", "alias": "bulk"}, {"url": "nope"}, {"url": "https://other.org/three", "life_time": "1h"}]}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   []string{`{"status":201,"link":{"code":"bulk"`, `{"status":400,"error":{"code":"invalid_url"`, `"url":"https://other.org/three"`, `"expires_at"`},
+		},
+		{name: "bulk without links", method: http.MethodPost, path: "/api/v1/links/bulk", body: `{"links": []}`, expectedStatus: http.StatusBadRequest},
+		{name: "get", method: http.MethodGet, path: "/api/v1/links/first", expectedStatus: http.StatusOK, expectedBody: []string{`"url":"https://example.com/one"`}},
+		{name: "get link aliased bulk", method: http.MethodGet, path: "/api/v1/links/bulk", expectedStatus: http.StatusOK, expectedBody: []string{`"url":"https://example.com/two"`}},
+		{name: "get someone else's link", method: http.MethodGet, path: "/api/v1/links/first", telegramID: "2", expectedStatus: http.StatusNotFound, expectedBody: []string{`"code":"not_found"`}},
+		{name: "list", method: http.MethodGet, path: "/api/v1/links?limit=2", expectedStatus: http.StatusOK, expectedBody: []string{`"total":3`, `"limit":2`, `"offset":0`}},
+		{name: "list by url", method: http.MethodGet, path: "/api/v1/links?q=OTHER.org", expectedStatus: http.StatusOK, expectedBody: []string{`"total":1`, `https://other.org/three`}},
+		{name: "list with invalid limit", method: http.MethodGet, path: "/api/v1/links?limit=1000", expectedStatus: http.StatusBadRequest, expectedBody: []string{`"code":"invalid_limit"`}},
+		{name: "disable", method: http.MethodPatch, path: "/api/v1/links/first", body: `{"disabled": true}`, expectedStatus: http.StatusOK, expectedBody: []string{`"disabled":true`}},
+		{name: "list disabled", method: http.MethodGet, path: "/api/v1/links?status=disabled", expectedStatus: http.StatusOK, expectedBody: []string{`"total":1`, `"code":"first"`}},
+		{name: "change destination", method: http.MethodPatch, path: "/api/v1/links/first", body: `{"url": "https://example.com/moved", "disabled": false}`, expectedStatus: http.StatusOK, expectedBody: []string{`"url":"https://example.com/moved"`, `"disabled":false`}},
+		{name: "empty update", method: http.MethodPatch, path: "/api/v1/links/first", body: `{}`, expectedStatus: http.StatusBadRequest},
+		{name: "stats", method: http.MethodGet, path: "/api/v1/links/first/stats?days=7", expectedStatus: http.StatusOK, expectedBody: []string{`"total_clicks":0`}},
+		{name: "stats with invalid days", method: http.MethodGet, path: "/api/v1/links/first/stats?days=0", expectedStatus: http.StatusBadRequest},
+		{name: "delete", method: http.MethodDelete, path: "/api/v1/links/first", expectedStatus: http.StatusNoContent},
+		{name: "get deleted", method: http.MethodGet, path: "/api/v1/links/first", expectedStatus: http.StatusNotFound},
+		{name: "method not allowed", method: http.MethodPut, path: "/api/v1/links", expectedStatus: http.StatusMethodNotAllowed, expectedBody: []string{`"code":"method_not_allowed"`}},
+	}
+
+	api, _ := newTestApi(t)
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			req := httptest.NewRequest(step.method, step.path, bytes.NewBufferString(step.body))
+			req.Header.Set("Content-Type", "application/json")
+			if step.path != "/api/v1/openapi.json" {
+				telegramID := step.telegramID
+				if telegramID == "" {
+					telegramID = "1"
+				}
+				req.Header.Set("X-Telegram-ID", telegramID)
+			}
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+
+			if w.Code != step.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", step.expectedStatus, w.Code, w.Body.String())
+			}
+			for _, expected := range step.expectedBody {
+				if !strings.Contains(w.Body.String(), expected) {
+					t.Errorf("expected body to contain %s, got %s", expected, w.Body.String())
+				}
+			}
+			if w.Code >= 400 && !json.Valid(w.Body.Bytes()) {
+				t.Errorf("expected a JSON error body, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestApiV1_ListStatus(t *testing.T) {
+	api, db := newTestApi(t)
+
+	now := time.Now().UTC()
+	future, past := now.Add(time.Hour), now.Add(-time.Hour)
+	for _, link := range []models.Url{
+		{Telegram_id: 1, Hash: "forever", Url: "https://example.com/forever"},
+		{Telegram_id: 1, Hash: "later", Url: "https://example.com/later", Expires_at: &future},
+		{Telegram_id: 1, Hash: "gone", Url: "https://example.com/gone", Expires_at: &past},
+		{Telegram_id: 1, Hash: "off", Url: "https://example.com/off", Disabled: true},
+	} {
+		if _, err := db.Insert("urls", link); err != nil {
+			t.Fatalf("failed to seed link: %v", err)
+		}
+	}
+
+	tests := []struct {
+		status   string
+		expected []string
+	}{
+		{status: "active", expected: []string{"forever", "later"}},
+		{status: "expired", expected: []string{"gone"}},
+		{status: "disabled", expected: []string{"off"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/links?status="+tt.status, nil)
+			req.Header.Set("X-Telegram-ID", "1")
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, req)
+
+			var list struct {
+				Total int `json:"total"`
+				Links []struct {
+					Code string `json:"code"`
+				} `json:"links"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+				t.Fatalf("unexpected body %s", w.Body.String())
+			}
+
+			codes := []string{}
+			for _, link := range list.Links {
+				codes = append(codes, link.Code)
+			}
+			sort.Strings(codes)
+			if list.Total != len(tt.expected) || strings.Join(codes, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected %v, got %v (total %d)", tt.expected, codes, list.Total)
+			}
+		})
+	}
+}
+
+type mockKeys map[string]int64
+
+func (m mockKeys) Resolve(key string) (int64, error) {
+	if id, ok := m[key]; ok {
+		return id, nil
+	}
+	return 0, errors.New("invalid API key")
+}
+
+func TestApiV1_MiddlewareErrors(t *testing.T) {
+	db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "api.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	links := service.NewLinkService(db, &mockCache{data: map[string]string{}})
+	api := NewApiV1Handler(db, nil, links, analytics.NewReporter(db), &mockLogger{})
+
+	authenticate := middleware.AuthSchemeMiddleware(map[string]func(http.Handler) http.Handler{
+		"Bearer": middleware.ApiKeyMiddleware(mockKeys{"usb_valid": 1}, ""),
+	})
+	limit := middleware.RateLimitMiddleware(middleware.NewMemoryStore(nil),
+		middleware.Policy{Name: "api", Requests: 1, Period: time.Hour, Burst: 1, Key: middleware.KeyIP}, nil)
+
+	r := mux.NewRouter()
+	r.Use(middleware.ClientIPMiddleware(middleware.NewIPResolver(nil)))
+	api.RegisterRoutes(r, func(next http.Handler) http.Handler { return authenticate(limit(next)) }, func(next http.Handler) http.Handler { return next })
+
+	steps := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "missing credentials", expectedStatus: http.StatusUnauthorized, expectedCode: "unauthorized"},
+		{name: "invalid key", authorization: "Bearer usb_invalid", expectedStatus: http.StatusUnauthorized, expectedCode: "unauthorized"},
+		{name: "allowed", authorization: "Bearer usb_valid", expectedStatus: http.StatusOK},
+		{name: "rate limited", authorization: "Bearer usb_valid", expectedStatus: http.StatusTooManyRequests, expectedCode: "rate_limited"},
+	}
+
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/links", nil)
+		if step.authorization != "" {
+			req.Header.Set("Authorization", step.authorization)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != step.expectedStatus {
+			t.Fatalf("%s: expected status %d, got %d (%s)", step.name, step.expectedStatus, w.Code, w.Body.String())
+		}
+		if step.expectedCode == "" {
+			continue
+		}
+
+		var body struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if w.Header().Get("Content-Type") != "application/json" || json.Unmarshal(w.Body.Bytes(), &body) != nil {
+			t.Fatalf("%s: expected a JSON error, got %q", step.name, w.Body.String())
+		}
+		if body.Error.Code != step.expectedCode || body.Error.Message == "" {
+			t.Errorf("%s: expected error code %q, got %+v", step.name, step.expectedCode, body.Error)
+		}
+	}
+}
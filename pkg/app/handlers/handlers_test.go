@@ -6,9 +6,14 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"url-shorter-bot/pkg/analytics"
+	"url-shorter-bot/pkg/app/service"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/database"
 	"url-shorter-bot/pkg/middleware"
 	"url-shorter-bot/pkg/models"
 
@@ -38,9 +43,24 @@ func (m *mockCache) Delete(key string) {
 	delete(m.data, key)
 }
 
+type stubUsers struct{}
+
+func (u *stubUsers) Resolve(telegramID int64) (string, error) {
+	return fmt.Sprintf("uuid-%d", telegramID), nil
+}
+
+func (u *stubUsers) Register(telegramID int64, nickName string) (string, error) {
+	return u.Resolve(telegramID)
+}
+
 type mockSupabase struct {
-	data map[string]string
-	bad  bool
+	data     map[string]string
+	expires  map[string]time.Time
+	owners   map[string]int64
+	disabled map[string]bool
+	clicks   []models.Click
+	history  []models.UrlHistory
+	bad      bool
 }
 
 func (m *mockSupabase) Get(table string, target map[string]string) ([]byte, error) {
@@ -50,15 +70,36 @@ func (m *mockSupabase) Get(table string, target map[string]string) ([]byte, erro
 	}
 	val, ok := m.data[hash]
 	if !ok {
-		return nil, fmt.Errorf("not found")
+		return nil, fmt.Errorf("hash %s: %w", hash, database.ErrNotFound)
 	}
-	return json.Marshal(models.Url{
-		Hash: hash,
-		Url:  val,
-	})
+	if owner, ok := target["Telegram_id"]; ok && owner != fmt.Sprint(m.owners[hash]) {
+		return nil, fmt.Errorf("hash %s: %w", hash, database.ErrNotFound)
+	}
+	link := models.Url{
+		Telegram_id: m.owners[hash],
+		Hash:        hash,
+		Url:         val,
+		Disabled:    m.disabled[hash],
+	}
+	if expiresAt, ok := m.expires[hash]; ok {
+		link.Expires_at = &expiresAt
+	}
+	return json.Marshal(link)
+}
+
+func (m *mockSupabase) Select(table string, query string) ([]byte, error) {
+	return json.Marshal(m.clicks)
+}
+
+func (m *mockSupabase) Count(table string, filter string) (int, error) {
+	return len(m.clicks), nil
 }
 
 func (m *mockSupabase) Insert(table string, data interface{}) ([]byte, error) {
+	if h, ok := data.(models.UrlHistory); ok {
+		m.history = append(m.history, h)
+		return json.Marshal(h)
+	}
 	u, ok := data.(models.Url)
 	if !ok {
 		return nil, fmt.Errorf("invalid insert format")
@@ -67,10 +108,44 @@ func (m *mockSupabase) Insert(table string, data interface{}) ([]byte, error) {
 	return json.Marshal(u)
 }
 
+func (m *mockSupabase) Update(table, filter string, data interface{}) ([]byte, error) {
+	hash := strings.TrimPrefix(strings.Split(filter, "&")[0], "Hash=eq.")
+	if url, ok := data.(map[string]interface{})["Url"]; ok {
+		m.data[hash] = url.(string)
+	}
+	return []byte(`[]`), nil
+}
+
 func (m *mockSupabase) Delete(table, filter string) ([]byte, error) {
 	return []byte(`{}`), nil
 }
 
+func (m *mockSupabase) Rpc(function string, params interface{}) ([]byte, error) {
+	if function == "take_link_quota" {
+		return []byte(`[{"allowed": true, "creation": "c1"}]`), nil
+	}
+	if function != "link_stats" {
+		return nil, fmt.Errorf("unknown function: %s", function)
+	}
+	hash := params.(map[string]interface{})["link_hash"]
+	total, visitors := 0, map[string]bool{}
+	for _, click := range m.clicks {
+		if click.Hash == hash {
+			total++
+			visitors[click.Ip_hash] = true
+		}
+	}
+	return json.Marshal(map[string]int{"total_clicks": total, "unique_visitors": len(visitors)})
+}
+
+type mockClicks struct {
+	recorded []models.Click
+}
+
+func (m *mockClicks) Record(click models.Click) {
+	m.recorded = append(m.recorded, click)
+}
+
 type mockLogger struct {
 	db *mockSupabase
 }
@@ -86,6 +161,7 @@ func TestHandlerHashUrl(t *testing.T) {
 		setupCache     func(m *mockCache)
 		setupDB        func(db *mockSupabase)
 		expectedStatus int
+		expectedClicks int
 	}{
 		{
 			name:   "redirect from cache",
@@ -96,6 +172,7 @@ func TestHandlerHashUrl(t *testing.T) {
 			},
 			setupDB:        func(db *mockSupabase) {},
 			expectedStatus: http.StatusFound,
+			expectedClicks: 1,
 		},
 		{
 			name:       "redirect from Supabase",
@@ -106,6 +183,7 @@ func TestHandlerHashUrl(t *testing.T) {
 				db.data["xyz456"] = "https://from-db.com"
 			},
 			expectedStatus: http.StatusFound,
+			expectedClicks: 1,
 		},
 		{
 			name:           "missing method",
@@ -123,6 +201,40 @@ func TestHandlerHashUrl(t *testing.T) {
 			setupDB:        func(db *mockSupabase) {},
 			expectedStatus: http.StatusNotFound,
 		},
+		{
+			name:       "expired link",
+			method:     http.MethodGet,
+			url:        "/old789",
+			setupCache: func(m *mockCache) {},
+			setupDB: func(db *mockSupabase) {
+				db.data["old789"] = "https://expired.com"
+				db.expires["old789"] = time.Now().Add(-time.Minute)
+			},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:       "disabled link",
+			method:     http.MethodGet,
+			url:        "/off789",
+			setupCache: func(m *mockCache) {},
+			setupDB: func(db *mockSupabase) {
+				db.data["off789"] = "https://disabled.com"
+				db.disabled = map[string]bool{"off789": true}
+			},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:       "not yet expired link",
+			method:     http.MethodGet,
+			url:        "/new789",
+			setupCache: func(m *mockCache) {},
+			setupDB: func(db *mockSupabase) {
+				db.data["new789"] = "https://fresh.com"
+				db.expires["new789"] = time.Now().Add(time.Hour)
+			},
+			expectedStatus: http.StatusFound,
+			expectedClicks: 1,
+		},
 		{
 			name:       "invalid JSON from Supabase",
 			method:     http.MethodGet,
@@ -147,16 +259,20 @@ func TestHandlerHashUrl(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cache := &mockCache{data: make(map[string]string)}
-			db := &mockSupabase{data: make(map[string]string)}
+			db := &mockSupabase{data: make(map[string]string), expires: make(map[string]time.Time)}
 			log := &mockLogger{db: db}
 			tt.setupCache(cache)
 			tt.setupDB(db)
 
-			handler := NewHashedUrlHandler(cache, db, log)
+			clicks := &mockClicks{}
+			handler := NewHashedUrlHandler(cache, db, log, clicks)
 			r := mux.NewRouter()
 			r.HandleFunc("/{url}", handler.HandlerHashUrl)
 
 			req := httptest.NewRequest(tt.method, tt.url, nil)
+			req.Header.Set("Referer", "https://t.me/channel")
+			// not behind a trusted proxy, so the country is not taken from the client
+			req.Header.Set("CF-IPCountry", "DE")
 			w := httptest.NewRecorder()
 
 			r.ServeHTTP(w, req)
@@ -164,10 +280,39 @@ func TestHandlerHashUrl(t *testing.T) {
 			if w.Code != tt.expectedStatus {
 				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
 			}
+			if len(clicks.recorded) != tt.expectedClicks {
+				t.Fatalf("expected %d recorded clicks, got %d", tt.expectedClicks, len(clicks.recorded))
+			}
+			if tt.expectedClicks > 0 && (clicks.recorded[0].Referrer != "https://t.me/channel" || clicks.recorded[0].Ip_hash == "" || clicks.recorded[0].Country != "") {
+				t.Errorf("unexpected click: %+v", clicks.recorded[0])
+			}
 		})
 	}
 }
 
+func TestHandlerHashUrl_CaseInsensitive(t *testing.T) {
+	models.Config.CodeCaseInsensitive = true
+	defer func() { models.Config.CodeCaseInsensitive = false }()
+
+	cache := &mockCache{data: make(map[string]string)}
+	db := &mockSupabase{data: map[string]string{"abc123": "https://from-db.com"}}
+	handler := NewHashedUrlHandler(cache, db, &mockLogger{db: db}, &mockClicks{})
+
+	r := mux.NewRouter()
+	r.HandleFunc("/"+shortcode.RoutePattern("abc123", true), handler.HandlerHashUrl)
+
+	req := httptest.NewRequest(http.MethodGet, "/ABC123", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("expected status %d, got %d", http.StatusFound, w.Code)
+	}
+	if w.Header().Get("Location") != "https://from-db.com" {
+		t.Errorf("unexpected redirect location %q", w.Header().Get("Location"))
+	}
+}
+
 func TestHandlerUrlShort(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -201,6 +346,54 @@ func TestHandlerUrlShort(t *testing.T) {
 			expectedStatus: http.StatusUnsupportedMediaType,
 			expectedText:   "invalid URL",
 		},
+		{
+			name:           "custom life time",
+			method:         http.MethodPost,
+			requestBody:    `{"Url":"https://valid.com","life_time":"7d"}`,
+			contentType:    "application/json",
+			expectedStatus: http.StatusOK,
+			expectedText:   "http://localhost/",
+		},
+		{
+			name:           "invalid life time",
+			method:         http.MethodPost,
+			requestBody:    `{"Url":"https://valid.com","life_time":"soon"}`,
+			contentType:    "application/json",
+			expectedStatus: http.StatusBadRequest,
+			expectedText:   "invalid life_time",
+		},
+		{
+			name:           "custom alias",
+			method:         http.MethodPost,
+			requestBody:    `{"Url":"https://valid.com","alias":"spring-sale"}`,
+			contentType:    "application/json",
+			expectedStatus: http.StatusOK,
+			expectedText:   "http://localhost/spring-sale",
+		},
+		{
+			name:           "reserved alias",
+			method:         http.MethodPost,
+			requestBody:    `{"Url":"https://valid.com","alias":"health"}`,
+			contentType:    "application/json",
+			expectedStatus: http.StatusBadRequest,
+			expectedText:   "invalid alias",
+		},
+		{
+			name:           "alias with spaces",
+			method:         http.MethodPost,
+			requestBody:    `{"Url":"https://valid.com","alias":"spring sale"}`,
+			contentType:    "application/json",
+			expectedStatus: http.StatusBadRequest,
+			expectedText:   "invalid alias",
+		},
+		{
+			name:           "duplicate alias",
+			method:         http.MethodPost,
+			requestBody:    `{"Url":"https://valid.com","alias":"taken-alias"}`,
+			contentType:    "application/json",
+			expectedStatus: http.StatusConflict,
+			expectedText:   "alias is already taken",
+		},
 		{
 			name:           "missing Content-Type",
 			method:         http.MethodPost,
@@ -234,9 +427,10 @@ func TestHandlerUrlShort(t *testing.T) {
 			req.Header.Set("X-Telegram-ID", "123456")
 
 			w := httptest.NewRecorder()
-			db := &mockSupabase{data: map[string]string{}}
+			db := &mockSupabase{data: map[string]string{"taken-alias": "https://someone-else.com"}}
 			log := &mockLogger{db: db}
-			handler := NewShortdUrlHandler(db, log)
+			generator, _ := shortcode.NewGenerator("random", "", 0)
+			handler := NewShortdUrlHandler(service.NewShortenerService(db, generator, service.Quota{}, &stubUsers{}), log)
 
 			r := mux.NewRouter()
 			r.HandleFunc("/short", handler.HandlerUrlShort)
@@ -254,3 +448,178 @@ func TestHandlerUrlShort(t *testing.T) {
 		})
 	}
 }
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Now()
+	soon := now.Add(2 * time.Minute)
+	later := now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		link     models.Url
+		expected time.Duration
+	}{
+		{name: "no expiry", link: models.Url{}, expected: 10 * time.Minute},
+		{name: "expires before default ttl", link: models.Url{Expires_at: &soon}, expected: 2 * time.Minute},
+		{name: "expires after default ttl", link: models.Url{Expires_at: &later}, expected: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheTTL(tt.link, now); got != tt.expected {
+				t.Errorf("expected ttl %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHandlerStats(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedText   string
+	}{
+		{
+			name:           "owner gets stats",
+			url:            "/stats/mine",
+			expectedStatus: http.StatusOK,
+			expectedText:   `"total_clicks":2`,
+		},
+		{
+			name:           "custom period",
+			url:            "/stats/mine?days=7",
+			expectedStatus: http.StatusOK,
+			expectedText:   `"unique_visitors":1`,
+		},
+		{
+			name:           "invalid period",
+			url:            "/stats/mine?days=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "someone else's link",
+			url:            "/stats/theirs",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "unknown link",
+			url:            "/stats/missing",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockSupabase{
+				data:   map[string]string{"mine": "https://mine.com", "theirs": "https://theirs.com"},
+				owners: map[string]int64{"mine": 123456, "theirs": 654321},
+				clicks: []models.Click{
+					{Hash: "mine", Ip_hash: "a", Created_at: time.Now()},
+					{Hash: "mine", Ip_hash: "a", Created_at: time.Now()},
+				},
+			}
+			handler := NewStatsHandler(db, analytics.NewReporter(db), &mockLogger{db: db})
+
+			r := mux.NewRouter()
+			r.Handle("/stats/{url}", middleware.TelegramIDMiddleware(http.HandlerFunc(handler.HandlerStats)))
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.Header.Set("X-Telegram-ID", "123456")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedText != "" && !bytes.Contains(w.Body.Bytes(), []byte(tt.expectedText)) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedText, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerEditLink(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		expectedStatus int
+		expectedURL    string
+	}{
+		{
+			name:           "owner changes destination",
+			method:         http.MethodPatch,
+			url:            "/api/links/mine",
+			body:           `{"url": "https://moved.com"}`,
+			expectedStatus: http.StatusOK,
+			expectedURL:    "https://moved.com",
+		},
+		{
+			name:           "invalid url",
+			method:         http.MethodPatch,
+			url:            "/api/links/mine",
+			body:           `{"url": "moved"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedURL:    "https://mine.com",
+		},
+		{
+			name:           "invalid JSON",
+			method:         http.MethodPatch,
+			url:            "/api/links/mine",
+			body:           `{`,
+			expectedStatus: http.StatusBadRequest,
+			expectedURL:    "https://mine.com",
+		},
+		{
+			name:           "someone else's link",
+			method:         http.MethodPatch,
+			url:            "/api/links/theirs",
+			body:           `{"url": "https://moved.com"}`,
+			expectedStatus: http.StatusNotFound,
+			expectedURL:    "https://mine.com",
+		},
+		{
+			name:           "wrong method",
+			method:         http.MethodPost,
+			url:            "/api/links/mine",
+			body:           `{"url": "https://moved.com"}`,
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedURL:    "https://mine.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockSupabase{
+				data:   map[string]string{"mine": "https://mine.com", "theirs": "https://theirs.com"},
+				owners: map[string]int64{"mine": 123456, "theirs": 654321},
+			}
+			cache := &mockCache{data: map[string]string{"mine": "https://mine.com"}}
+			handler := NewLinksHandler(service.NewLinkService(db, cache), &mockLogger{db: db})
+
+			r := mux.NewRouter()
+			r.Handle("/api/links/{url}", middleware.TelegramIDMiddleware(http.HandlerFunc(handler.HandlerEditLink)))
+
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("X-Telegram-ID", "123456")
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if db.data["mine"] != tt.expectedURL {
+				t.Errorf("expected destination %q, got %q", tt.expectedURL, db.data["mine"])
+			}
+			if _, cached := cache.data["mine"]; cached == (tt.expectedStatus == http.StatusOK) {
+				t.Errorf("expected the cached redirect to be dropped only after a change")
+			}
+			if tt.expectedStatus == http.StatusOK && (len(db.history) != 1 || db.history[0].Old_url != "https://mine.com") {
+				t.Errorf("expected the previous destination in history, got %+v", db.history)
+			}
+		})
+	}
+}
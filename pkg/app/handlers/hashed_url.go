@@ -5,9 +5,13 @@ import (
 	"net/http"
 	"time"
 
+	"url-shorter-bot/pkg/analytics"
+	"url-shorter-bot/pkg/app/shortcode"
 	"url-shorter-bot/pkg/cache"
 	"url-shorter-bot/pkg/database"
 	"url-shorter-bot/pkg/logger"
+	"url-shorter-bot/pkg/metrics"
+	"url-shorter-bot/pkg/middleware"
 	"url-shorter-bot/pkg/models"
 
 	"github.com/gorilla/mux"
@@ -17,34 +21,46 @@ type UrlHashHandler struct {
 	cache  cache.Cache
 	db     database.SupabaseClient
 	logger logger.Logger
+	clicks analytics.ClickRecorder
 }
 
-func NewHashedUrlHandler(c cache.Cache, db database.SupabaseClient, log logger.Logger) *UrlHashHandler {
-	return &UrlHashHandler{cache: c, db: db, logger: log}
+func NewHashedUrlHandler(c cache.Cache, db database.SupabaseClient, log logger.Logger, clicks analytics.ClickRecorder) *UrlHashHandler {
+	return &UrlHashHandler{cache: c, db: db, logger: log, clicks: clicks}
 }
 
 func (h *UrlHashHandler) HandlerHashUrl(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	status := metrics.NewStatusWriter(w)
+	w = status
+	defer func() {
+		metrics.Redirects.Inc(status.StatusLabel())
+		metrics.RedirectDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	if r.Method != http.MethodGet {
 		http.Error(w, "must be only GET", http.StatusMethodNotAllowed)
 		return
 	}
 
-	hashUrl := mux.Vars(r)["url"]
+	hashUrl := shortcode.Normalize(mux.Vars(r)["url"], models.Config.CodeCaseInsensitive)
 	if hashUrl == "" {
 		http.Error(w, "missing hash url", http.StatusBadRequest)
 		return
 	}
 
 	if cachedUrl, ok := h.cache.Get(hashUrl); ok {
+		metrics.CacheRequests.Inc("hit")
 		cachedUrlString, ok := cachedUrl.(string)
 		if !ok {
 			http.Error(w, "Error", http.StatusBadRequest)
 			return
 		}
 
+		h.recordClick(r, hashUrl)
 		http.Redirect(w, r, cachedUrlString, http.StatusFound)
 		return
 	}
+	metrics.CacheRequests.Inc("miss")
 
 	valBytes, err := h.db.Get("urls", map[string]string{
 		"Hash": hashUrl,
@@ -61,11 +77,54 @@ func (h *UrlHashHandler) HandlerHashUrl(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	go h.cache.Set(hashUrl, result.Url, 10*time.Minute)
+	if result.IsExpired(time.Now()) {
+		http.Error(w, "link has expired", http.StatusGone)
+		return
+	}
 
-	go func(h *UrlHashHandler) {
-		h.logger.LogAction(result.Telegram_id, "users url has been used")
-	}(h)
+	if result.Disabled {
+		http.Error(w, "link has been disabled", http.StatusGone)
+		return
+	}
 
+	// set before responding, so a later eviction by LinkService is not undone
+	// by a write still in flight
+	h.cache.Set(hashUrl, result.Url, cacheTTL(result, time.Now()))
+
+	h.logger.LogAction(result.Telegram_id, "users url has been used")
+
+	h.recordClick(r, hashUrl)
 	http.Redirect(w, r, result.Url, http.StatusFound)
 }
+
+func (h *UrlHashHandler) recordClick(r *http.Request, hashUrl string) {
+	// addresses of one IPv6 host count as one visitor
+	ip := middleware.IPGroup(middleware.ClientIP(r))
+
+	h.clicks.Record(models.Click{
+		Hash:       hashUrl,
+		Referrer:   truncate(r.Referer(), 512),
+		User_agent: truncate(r.UserAgent(), 512),
+		Ip_hash:    analytics.HashIP(ip, models.Config.IpHashSalt),
+		Country:    truncate(middleware.ClientCountry(r), 2),
+		Created_at: time.Now().UTC(),
+	})
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
+
+// cacheTTL keeps a cached redirect from outliving the link it points to.
+func cacheTTL(link models.Url, now time.Time) time.Duration {
+	ttl := 10 * time.Minute
+	if link.Expires_at != nil {
+		if left := link.Expires_at.Sub(now); left < ttl {
+			ttl = left
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"url-shorter-bot/pkg/app/service"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/logger"
+	"url-shorter-bot/pkg/middleware"
+	"url-shorter-bot/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+type LinksHandler struct {
+	links  *service.LinkService
+	logger logger.Logger
+}
+
+func NewLinksHandler(links *service.LinkService, log logger.Logger) *LinksHandler {
+	return &LinksHandler{links: links, logger: log}
+}
+
+// HandlerEditLink changes the destination of a link owned by the caller.
+func (h *LinksHandler) HandlerEditLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "must be only PATCH", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "invalid content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	telegramIDValue := r.Context().Value(middleware.TelegramIDKey)
+	if telegramIDValue == nil {
+		http.Error(w, "No telegram_id in context", http.StatusInternalServerError)
+		return
+	}
+	telegramID := telegramIDValue.(int64)
+
+	var reqData models.RequestData
+	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	hashUrl := shortcode.Normalize(mux.Vars(r)["url"], models.Config.CodeCaseInsensitive)
+
+	link, err := h.links.ChangeURL(telegramID, hashUrl, reqData.Url)
+	switch {
+	case errors.Is(err, service.ErrInvalidURL):
+		http.Error(w, "invalid URL", http.StatusBadRequest)
+		return
+	case errors.Is(err, service.ErrLinkNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		h.logger.LogError(telegramID, err.Error(), "500")
+		http.Error(w, "failed to update link", http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.LogAction(telegramID, "changed url of link "+hashUrl)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(link)
+}
@@ -2,23 +2,23 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
-	"url-shorter-bot/pkg/app/validators"
-	"url-shorter-bot/pkg/database"
+	"net/url"
+	"url-shorter-bot/pkg/app/service"
 	"url-shorter-bot/pkg/logger"
 	"url-shorter-bot/pkg/middleware"
 	"url-shorter-bot/pkg/models"
 )
 
 type UrlShortHandler struct {
-	db     database.SupabaseClient
-	logger logger.Logger
+	shortener *service.ShortenerService
+	logger    logger.Logger
 }
 
-func NewShortdUrlHandler(db database.SupabaseClient, log logger.Logger) *UrlShortHandler {
-	return &UrlShortHandler{db: db, logger: log}
+func NewShortdUrlHandler(shortener *service.ShortenerService, log logger.Logger) *UrlShortHandler {
+	return &UrlShortHandler{shortener: shortener, logger: log}
 }
 
 func (h *UrlShortHandler) HandlerUrlShort(w http.ResponseWriter, r *http.Request) {
@@ -39,45 +39,38 @@ func (h *UrlShortHandler) HandlerUrlShort(w http.ResponseWriter, r *http.Request
 	}
 	telegramID := telegramIDValue.(int64)
 
-	go h.logger.LogAction(telegramID, "shortened link")
+	h.logger.LogAction(telegramID, "shortened link")
 
 	var reqData models.RequestData
 	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
-		go h.logger.LogError(telegramID, err.Error(), "415")
+		h.logger.LogError(telegramID, err.Error(), "415")
 		http.Error(w, "invalid JSON body", http.StatusUnsupportedMediaType)
 		return
 	}
 
-	if ok := validators.IsValidURL(reqData.Url); ok {
-		hashUrl := validators.ShortToHash(reqData.Url + strconv.Itoa(int(telegramID)))
-		hashUrlString := strconv.Itoa(int(hashUrl))
-
-		_, err := h.db.Get("urls", map[string]string{
-			"Hash": hashUrlString,
-		})
-		if err == nil {
-			makeResponse(models.Protocol, models.Config.HostName, models.PortForUrl, hashUrlString, w)
-			return
-		}
-
-		go func(telegramID int64, hashUrlString, Url string, h *UrlShortHandler) {
-			_, err := h.db.Insert("urls", models.Url{Telegram_id: telegramID, Hash: hashUrlString, Url: Url})
-			if err != nil {
-				go h.logger.LogError(telegramID, err.Error(), "400")
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-		}(telegramID, hashUrlString, reqData.Url, h)
-
-		makeResponse(models.Protocol, models.Config.HostName, models.PortForUrl, hashUrlString, w)
-	} else {
+	link, err := h.shortener.Shorten(telegramID, reqData)
+	switch {
+	case errors.Is(err, service.ErrInvalidURL):
 		http.Error(w, "invalid URL", http.StatusUnsupportedMediaType)
+	case errors.Is(err, service.ErrInvalidLifeTime):
+		http.Error(w, "invalid life_time", http.StatusBadRequest)
+	case errors.Is(err, service.ErrInvalidAlias):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrAliasTaken):
+		http.Error(w, "alias is already taken", http.StatusConflict)
+	case errors.Is(err, service.ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case err != nil:
+		h.logger.LogError(telegramID, err.Error(), "500")
+		http.Error(w, "failed to create short url", http.StatusInternalServerError)
+	default:
+		makeResponse(models.Protocol, models.Config.HostName, models.PortForUrl, link.Hash, w)
 	}
 }
 
 func makeResponse(Protocol, HostName, PortForUrl, hashUrlString string, w http.ResponseWriter) {
 	response := models.Respons{
-		Url: fmt.Sprintf("%s://%s%s/%s", Protocol, HostName, PortForUrl, hashUrlString),
+		Url: fmt.Sprintf("%s://%s%s/%s", Protocol, HostName, PortForUrl, url.PathEscape(hashUrlString)),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"url-shorter-bot/pkg/analytics"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/logger"
+	"url-shorter-bot/pkg/middleware"
+	"url-shorter-bot/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+const defaultStatsDays = 30
+
+type StatsHandler struct {
+	db       database.SupabaseClient
+	reporter *analytics.Reporter
+	logger   logger.Logger
+}
+
+func NewStatsHandler(db database.SupabaseClient, reporter *analytics.Reporter, log logger.Logger) *StatsHandler {
+	return &StatsHandler{db: db, reporter: reporter, logger: log}
+}
+
+func (h *StatsHandler) HandlerStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "must be only GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	telegramIDValue := r.Context().Value(middleware.TelegramIDKey)
+	if telegramIDValue == nil {
+		http.Error(w, "No telegram_id in context", http.StatusInternalServerError)
+		return
+	}
+	telegramID := telegramIDValue.(int64)
+
+	hashUrl := shortcode.Normalize(mux.Vars(r)["url"], models.Config.CodeCaseInsensitive)
+
+	days := defaultStatsDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 365 {
+			http.Error(w, "days must be between 1 and 365", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	valBytes, err := h.db.Get("urls", map[string]string{
+		"Hash": hashUrl,
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to load link", http.StatusInternalServerError)
+		return
+	}
+
+	var link models.Url
+	if err := json.Unmarshal(valBytes, &link); err != nil {
+		http.Error(w, "invalid data from DB", http.StatusInternalServerError)
+		return
+	}
+	if link.Telegram_id != telegramID {
+		http.NotFound(w, r)
+		return
+	}
+
+	stats, err := h.reporter.LinkStats(hashUrl, days)
+	if err != nil {
+		h.logger.LogError(telegramID, err.Error(), "500")
+		http.Error(w, "failed to load stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
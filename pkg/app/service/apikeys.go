@@ -0,0 +1,103 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/models"
+)
+
+// apiKeyPrefix makes keys recognizable in configs and secret scanners.
+const apiKeyPrefix = "usb_"
+
+// ErrInvalidApiKey is returned for unknown and revoked keys.
+var ErrInvalidApiKey = errors.New("invalid API key")
+
+// ApiKeyService issues per-user API keys. Only the SHA-256 of a key is
+// stored, the key itself is shown to its owner once.
+type ApiKeyService struct {
+	db database.SupabaseClient
+}
+
+func NewApiKeyService(db database.SupabaseClient) *ApiKeyService {
+	return &ApiKeyService{db: db}
+}
+
+// Issue revokes the active keys of telegramID and returns a new one.
+func (s *ApiKeyService) Issue(telegramID int64) (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+	keyHash := HashApiKey(key)
+
+	// the old keys keep working until the new one is stored
+	_, err := s.db.Insert("api_keys", models.ApiKey{
+		Telegram_id: telegramID,
+		Key_hash:    keyHash,
+		Prefix:      key[:len(apiKeyPrefix)+6],
+	})
+	if err != nil {
+		return "", err
+	}
+
+	filter := fmt.Sprintf("Telegram_id=eq.%d&Revoked=is.false&Key_hash=neq.%s", telegramID, keyHash)
+	if _, err := s.db.Update("api_keys", filter, map[string]interface{}{"Revoked": true}); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Revoke disables every active key of telegramID.
+func (s *ApiKeyService) Revoke(telegramID int64) error {
+	filter := fmt.Sprintf("Telegram_id=eq.%d&Revoked=is.false", telegramID)
+	_, err := s.db.Update("api_keys", filter, map[string]interface{}{"Revoked": true})
+	return err
+}
+
+// Active returns the active key of telegramID, without the secret part.
+func (s *ApiKeyService) Active(telegramID int64) (models.ApiKey, bool, error) {
+	body, err := s.db.Select("api_keys", fmt.Sprintf("Telegram_id=eq.%d&Revoked=is.false&limit=1", telegramID))
+	if err != nil {
+		return models.ApiKey{}, false, err
+	}
+
+	var keys []models.ApiKey
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return models.ApiKey{}, false, err
+	}
+	if len(keys) == 0 {
+		return models.ApiKey{}, false, nil
+	}
+	return keys[0], true, nil
+}
+
+// Resolve returns the owner of an active key.
+func (s *ApiKeyService) Resolve(key string) (int64, error) {
+	body, err := s.db.Get("api_keys", map[string]string{
+		"Key_hash": HashApiKey(key),
+		"Revoked":  "false",
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		return 0, ErrInvalidApiKey
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var apiKey models.ApiKey
+	if err := json.Unmarshal(body, &apiKey); err != nil {
+		return 0, err
+	}
+	return apiKey.Telegram_id, nil
+}
+
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
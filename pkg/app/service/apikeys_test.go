@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"url-shorter-bot/pkg/database"
+)
+
+func TestApiKeyService(t *testing.T) {
+	db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	keys := NewApiKeyService(db)
+
+	first, err := keys.Issue(42)
+	if err != nil {
+		t.Fatalf("unexpected issue error: %v", err)
+	}
+	if !strings.HasPrefix(first, apiKeyPrefix) {
+		t.Errorf("expected key to start with %q, got %q", apiKeyPrefix, first)
+	}
+	if id, err := keys.Resolve(first); err != nil || id != 42 {
+		t.Fatalf("expected key to resolve to 42, got %d (%v)", id, err)
+	}
+
+	active, ok, err := keys.Active(42)
+	if err != nil || !ok || !strings.HasPrefix(first, active.Prefix) || active.Key_hash != HashApiKey(first) {
+		t.Fatalf("unexpected active key %+v (%v, %v)", active, ok, err)
+	}
+
+	second, err := keys.Issue(42)
+	if err != nil {
+		t.Fatalf("unexpected rotate error: %v", err)
+	}
+	if _, err := keys.Resolve(first); !errors.Is(err, ErrInvalidApiKey) {
+		t.Errorf("expected the rotated key to be invalid, got %v", err)
+	}
+	if id, err := keys.Resolve(second); err != nil || id != 42 {
+		t.Errorf("expected the new key to resolve to 42, got %d (%v)", id, err)
+	}
+
+	if err := keys.Revoke(42); err != nil {
+		t.Fatalf("unexpected revoke error: %v", err)
+	}
+	if _, err := keys.Resolve(second); !errors.Is(err, ErrInvalidApiKey) {
+		t.Errorf("expected the revoked key to be invalid, got %v", err)
+	}
+	if _, ok, _ := keys.Active(42); ok {
+		t.Errorf("expected no active key after revoke")
+	}
+	if _, err := keys.Resolve("usb_unknown"); !errors.Is(err, ErrInvalidApiKey) {
+		t.Errorf("expected unknown key to be invalid, got %v", err)
+	}
+}
+
+type failingInserts struct {
+	database.SupabaseClient
+}
+
+func (f failingInserts) Insert(table string, data interface{}) ([]byte, error) {
+	return nil, errors.New("db error")
+}
+
+func TestApiKeyService_FailedRotation(t *testing.T) {
+	db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "keys.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	first, err := NewApiKeyService(db).Issue(42)
+	if err != nil {
+		t.Fatalf("unexpected issue error: %v", err)
+	}
+
+	keys := NewApiKeyService(failingInserts{db})
+	if _, err := keys.Issue(42); err == nil {
+		t.Fatal("expected the rotation to fail")
+	}
+	if id, err := keys.Resolve(first); err != nil || id != 42 {
+		t.Errorf("expected the old key to keep working, got %d (%v)", id, err)
+	}
+}
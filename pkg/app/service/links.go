@@ -0,0 +1,127 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"url-shorter-bot/pkg/app/validators"
+	"url-shorter-bot/pkg/cache"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/models"
+)
+
+// ErrLinkNotFound is returned when the link does not exist or belongs to
+// someone else; callers must not be able to tell the two apart.
+var ErrLinkNotFound = errors.New("link not found")
+
+// ErrInvalidURL is returned when a new destination is not a valid URL.
+var ErrInvalidURL = errors.New("invalid URL")
+
+// LinkService changes links on behalf of their owners and keeps the
+// redirect cache in sync with the database.
+type LinkService struct {
+	db    database.SupabaseClient
+	cache cache.Cache
+}
+
+func NewLinkService(db database.SupabaseClient, c cache.Cache) *LinkService {
+	return &LinkService{db: db, cache: c}
+}
+
+// Owned loads the link stored under code if it belongs to telegramID.
+func (s *LinkService) Owned(telegramID int64, code string) (models.Url, error) {
+	var link models.Url
+
+	body, err := s.db.Get("urls", map[string]string{
+		"Hash":        code,
+		"Telegram_id": strconv.FormatInt(telegramID, 10),
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		return link, ErrLinkNotFound
+	}
+	if err != nil {
+		return link, err
+	}
+
+	err = json.Unmarshal(body, &link)
+	return link, err
+}
+
+// Delete removes the link for good, with its clicks and history.
+func (s *LinkService) Delete(telegramID int64, code string) error {
+	if _, err := s.Owned(telegramID, code); err != nil {
+		return err
+	}
+
+	if _, err := s.db.Delete("urls", ownerFilter(telegramID, code)); err != nil {
+		return err
+	}
+	s.cache.Delete(code)
+
+	return purgeActivity(s.db, code)
+}
+
+// SetDisabled stops (or resumes) redirects of the link without deleting it.
+func (s *LinkService) SetDisabled(telegramID int64, code string, disabled bool) error {
+	if _, err := s.Owned(telegramID, code); err != nil {
+		return err
+	}
+
+	_, err := s.db.Update("urls", ownerFilter(telegramID, code), map[string]interface{}{"Disabled": disabled})
+	if err != nil {
+		return err
+	}
+
+	s.cache.Delete(code)
+	return nil
+}
+
+// ChangeURL points the link at newURL. The previous destination is written
+// to url_history first so it is never lost.
+func (s *LinkService) ChangeURL(telegramID int64, code, newURL string) (models.Url, error) {
+	if !validators.IsValidURL(newURL) {
+		return models.Url{}, ErrInvalidURL
+	}
+
+	link, err := s.Owned(telegramID, code)
+	if err != nil {
+		return link, err
+	}
+	if link.Url == newURL {
+		return link, nil
+	}
+
+	_, err = s.db.Insert("url_history", models.UrlHistory{
+		Telegram_id: telegramID,
+		Hash:        code,
+		Old_url:     link.Url,
+		New_url:     newURL,
+	})
+	if err != nil {
+		return link, err
+	}
+
+	if _, err := s.db.Update("urls", ownerFilter(telegramID, code), map[string]interface{}{"Url": newURL}); err != nil {
+		return link, err
+	}
+
+	s.cache.Delete(code)
+	link.Url = newURL
+	return link, nil
+}
+
+// purgeActivity deletes the clicks and url_history rows recorded under code,
+// so a link that reuses the code does not inherit them.
+func purgeActivity(db database.SupabaseClient, code string) error {
+	for _, table := range []string{"clicks", "url_history"} {
+		if _, err := db.Delete(table, "Hash=eq."+code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ownerFilter(telegramID int64, code string) string {
+	return fmt.Sprintf("Hash=eq.%s&Telegram_id=eq.%d", code, telegramID)
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/models"
+)
+
+type mockSupabase struct {
+	links   map[string]models.Url
+	history []models.UrlHistory
+	filters []string
+	err     error
+}
+
+func (m *mockSupabase) Get(table string, target map[string]string) ([]byte, error) {
+	link, ok := m.links[target["Hash"]]
+	if !ok || fmt.Sprint(link.Telegram_id) != target["Telegram_id"] {
+		return nil, fmt.Errorf("no rows: %w", database.ErrNotFound)
+	}
+	return json.Marshal(link)
+}
+
+func (m *mockSupabase) Select(table string, query string) ([]byte, error) {
+	return []byte(`[]`), nil
+}
+
+func (m *mockSupabase) Count(table string, filter string) (int, error) {
+	return 0, nil
+}
+
+func (m *mockSupabase) Insert(table string, data interface{}) ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.history = append(m.history, data.(models.UrlHistory))
+	return []byte(`[]`), nil
+}
+
+func (m *mockSupabase) Update(table string, filter string, data interface{}) ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.filters = append(m.filters, filter)
+	hash := strings.TrimPrefix(strings.Split(filter, "&")[0], "Hash=eq.")
+	link := m.links[hash]
+	fields := data.(map[string]interface{})
+	if disabled, ok := fields["Disabled"]; ok {
+		link.Disabled = disabled.(bool)
+	}
+	if url, ok := fields["Url"]; ok {
+		link.Url = url.(string)
+	}
+	m.links[hash] = link
+	return json.Marshal([]models.Url{link})
+}
+
+func (m *mockSupabase) Delete(table string, filter string) ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if table != "urls" {
+		return []byte{}, nil
+	}
+	m.filters = append(m.filters, filter)
+	delete(m.links, strings.TrimPrefix(strings.Split(filter, "&")[0], "Hash=eq."))
+	return []byte{}, nil
+}
+
+func (m *mockSupabase) Rpc(function string, params interface{}) ([]byte, error) {
+	return nil, fmt.Errorf("unknown function: %s", function)
+}
+
+type mockCache struct {
+	data map[string]interface{}
+}
+
+func (m *mockCache) Set(key string, value interface{}, duration time.Duration) {
+	m.data[key] = value
+}
+
+func (m *mockCache) Get(key string) (interface{}, bool) {
+	v, ok := m.data[key]
+	return v, ok
+}
+
+func (m *mockCache) Delete(key string) {
+	delete(m.data, key)
+}
+
+func TestLinkService(t *testing.T) {
+	tests := []struct {
+		name         string
+		telegramID   int64
+		action       func(s *LinkService, telegramID int64) error
+		dbErr        error
+		expectErr    error
+		expectFilter string
+		expectLink   bool
+		expectOff    bool
+		expectCached bool
+	}{
+		{
+			name:         "delete own link",
+			telegramID:   1,
+			action:       func(s *LinkService, id int64) error { return s.Delete(id, "abc") },
+			expectFilter: "Hash=eq.abc&Telegram_id=eq.1",
+		},
+		{
+			name:         "disable own link",
+			telegramID:   1,
+			action:       func(s *LinkService, id int64) error { return s.SetDisabled(id, "abc", true) },
+			expectFilter: "Hash=eq.abc&Telegram_id=eq.1",
+			expectLink:   true,
+			expectOff:    true,
+		},
+		{
+			name:         "delete someone else's link",
+			telegramID:   2,
+			action:       func(s *LinkService, id int64) error { return s.Delete(id, "abc") },
+			expectErr:    ErrLinkNotFound,
+			expectLink:   true,
+			expectCached: true,
+		},
+		{
+			name:         "disable someone else's link",
+			telegramID:   2,
+			action:       func(s *LinkService, id int64) error { return s.SetDisabled(id, "abc", true) },
+			expectErr:    ErrLinkNotFound,
+			expectLink:   true,
+			expectCached: true,
+		},
+		{
+			name:         "database error keeps the cache",
+			telegramID:   1,
+			action:       func(s *LinkService, id int64) error { return s.Delete(id, "abc") },
+			dbErr:        errors.New("db down"),
+			expectLink:   true,
+			expectCached: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockSupabase{
+				links: map[string]models.Url{"abc": {Telegram_id: 1, Hash: "abc", Url: "https://example.com"}},
+				err:   tt.dbErr,
+			}
+			c := &mockCache{data: map[string]interface{}{"abc": "https://example.com"}}
+
+			err := tt.action(NewLinkService(db, c), tt.telegramID)
+			switch {
+			case tt.expectErr != nil && !errors.Is(err, tt.expectErr):
+				t.Fatalf("expected %v, got %v", tt.expectErr, err)
+			case tt.expectErr == nil && tt.dbErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.dbErr != nil && err == nil:
+				t.Fatalf("expected the database error")
+			}
+
+			if tt.expectFilter != "" && (len(db.filters) != 1 || db.filters[0] != tt.expectFilter) {
+				t.Errorf("expected filter %q, got %v", tt.expectFilter, db.filters)
+			}
+
+			link, exists := db.links["abc"]
+			if exists != tt.expectLink {
+				t.Errorf("expected link present = %v, got %v", tt.expectLink, exists)
+			}
+			if link.Disabled != tt.expectOff {
+				t.Errorf("expected disabled = %v, got %v", tt.expectOff, link.Disabled)
+			}
+			if _, cached := c.data["abc"]; cached != tt.expectCached {
+				t.Errorf("expected cached = %v, got %v", tt.expectCached, cached)
+			}
+		})
+	}
+}
+
+func TestLinkService_ChangeURL(t *testing.T) {
+	tests := []struct {
+		name          string
+		telegramID    int64
+		newURL        string
+		expectErr     error
+		expectURL     string
+		expectHistory int
+		expectCached  bool
+	}{
+		{name: "own link", telegramID: 1, newURL: "https://moved.com", expectURL: "https://moved.com", expectHistory: 1},
+		{name: "same destination", telegramID: 1, newURL: "https://example.com", expectURL: "https://example.com", expectCached: true},
+		{name: "invalid url", telegramID: 1, newURL: "moved", expectErr: ErrInvalidURL, expectURL: "https://example.com", expectCached: true},
+		{name: "someone else's link", telegramID: 2, newURL: "https://moved.com", expectErr: ErrLinkNotFound, expectURL: "https://example.com", expectCached: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockSupabase{
+				links: map[string]models.Url{"abc": {Telegram_id: 1, Hash: "abc", Url: "https://example.com"}},
+			}
+			c := &mockCache{data: map[string]interface{}{"abc": "https://example.com"}}
+
+			link, err := NewLinkService(db, c).ChangeURL(tt.telegramID, "abc", tt.newURL)
+			if !errors.Is(err, tt.expectErr) {
+				t.Fatalf("expected %v, got %v", tt.expectErr, err)
+			}
+			if err == nil && link.Url != tt.expectURL {
+				t.Errorf("expected returned url %q, got %q", tt.expectURL, link.Url)
+			}
+			if db.links["abc"].Url != tt.expectURL {
+				t.Errorf("expected stored url %q, got %q", tt.expectURL, db.links["abc"].Url)
+			}
+			if len(db.history) != tt.expectHistory {
+				t.Fatalf("expected %d history rows, got %d", tt.expectHistory, len(db.history))
+			}
+			if tt.expectHistory > 0 && (db.history[0].Old_url != "https://example.com" || db.history[0].New_url != tt.newURL) {
+				t.Errorf("unexpected history row: %+v", db.history[0])
+			}
+			if _, cached := c.data["abc"]; cached != tt.expectCached {
+				t.Errorf("expected cached = %v, got %v", tt.expectCached, cached)
+			}
+		})
+	}
+}
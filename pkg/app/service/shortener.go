@@ -0,0 +1,201 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/app/validators"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/models"
+	"url-shorter-bot/pkg/users"
+)
+
+var (
+	ErrInvalidAlias    = errors.New("invalid alias")
+	ErrInvalidLifeTime = errors.New("invalid life_time")
+	ErrAliasTaken      = errors.New("alias is already taken")
+	ErrQuotaExceeded   = errors.New("link quota exceeded")
+)
+
+// Quota limits how many links a Telegram user may create. A limit of zero
+// or less is not enforced.
+type Quota struct {
+	PerMinute int
+	PerDay    int
+}
+
+// ShortenerService creates short links for the HTTP API and the bot alike.
+type ShortenerService struct {
+	db        database.SupabaseClient
+	generator shortcode.Generator
+	quota     Quota
+	users     users.IdentityResolver
+}
+
+func NewShortenerService(db database.SupabaseClient, gen shortcode.Generator, quota Quota, users users.IdentityResolver) *ShortenerService {
+	return &ShortenerService{db: db, generator: gen, quota: quota, users: users}
+}
+
+// Shorten validates req and stores it as a link of telegramID. Errors of
+// the request are reported as ErrInvalidURL, ErrInvalidAlias,
+// ErrInvalidLifeTime, ErrAliasTaken and ErrQuotaExceeded.
+func (s *ShortenerService) Shorten(telegramID int64, req models.RequestData) (models.Url, error) {
+	if !validators.IsValidURL(req.Url) {
+		return models.Url{}, ErrInvalidURL
+	}
+
+	lifeTime, err := validators.ParseLifeTime(models.Config.UrlLifeTime)
+	if req.LifeTime != "" {
+		lifeTime, err = validators.ParseLifeTime(req.LifeTime)
+	}
+	if err != nil {
+		return models.Url{}, ErrInvalidLifeTime
+	}
+
+	alias := req.Alias
+	if alias != "" {
+		if err := validators.ValidateAlias(alias); err != nil {
+			return models.Url{}, fmt.Errorf("%w: %v", ErrInvalidAlias, err)
+		}
+		alias = shortcode.Normalize(alias, models.Config.CodeCaseInsensitive)
+	}
+
+	return s.createLink(telegramID, req.Url, alias, lifeTime)
+}
+
+// takeQuota records that telegramID creates a link under code, unless that
+// exceeds a quota window. The take_link_quota function counts and records
+// in one call, so concurrent requests cannot overshoot the quota. Creations
+// are kept in link_creations, so deleting links does not give the quota
+// back. It returns the id of the recorded creation.
+func (s *ShortenerService) takeQuota(telegramID int64, code string, now time.Time) (string, error) {
+	body, err := s.db.Rpc("take_link_quota", map[string]interface{}{
+		"creator":    telegramID,
+		"link_hash":  code,
+		"per_minute": s.quota.PerMinute,
+		"per_day":    s.quota.PerDay,
+		"at":         now.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var rows []struct {
+		Allowed  bool   `json:"allowed"`
+		Exceeded string `json:"exceeded"`
+		Creation string `json:"creation"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return "", err
+	}
+	if len(rows) != 1 {
+		return "", fmt.Errorf("take_link_quota returned %d rows", len(rows))
+	}
+	if !rows[0].Allowed {
+		limit := s.quota.PerMinute
+		if rows[0].Exceeded == "day" {
+			limit = s.quota.PerDay
+		}
+		return "", fmt.Errorf("%w: %d links per %s", ErrQuotaExceeded, limit, rows[0].Exceeded)
+	}
+	return rows[0].Creation, nil
+}
+
+// createLink stores rawUrl under alias, or under a free generated code when
+// alias is empty.
+func (s *ShortenerService) createLink(telegramID int64, rawUrl, alias string, lifeTime time.Duration) (models.Url, error) {
+	if alias != "" {
+		link, taken, err := s.reserveCode(alias, telegramID, rawUrl, lifeTime)
+		if err != nil {
+			return models.Url{}, err
+		}
+		if taken {
+			return models.Url{}, ErrAliasTaken
+		}
+		return link, nil
+	}
+
+	seed := rawUrl + strconv.Itoa(int(telegramID))
+
+	for attempt := 0; attempt < shortcode.MaxAttempts; attempt++ {
+		code, err := s.generator.Generate(seed, attempt)
+		if err != nil {
+			return models.Url{}, err
+		}
+
+		link, taken, err := s.reserveCode(code, telegramID, rawUrl, lifeTime)
+		if err != nil {
+			return models.Url{}, err
+		}
+		if !taken {
+			return link, nil
+		}
+	}
+
+	return models.Url{}, fmt.Errorf("no free short code after %d attempts", shortcode.MaxAttempts)
+}
+
+// reserveCode stores the link under code. A code already held by the same url
+// and user is reused unless it was disabled, any other link holding it is
+// reported as taken. The lookup only saves a failing insert: a link stored
+// in between is caught by the unique code and reported as taken too. Only
+// a newly stored link takes the quota of telegramID.
+func (s *ShortenerService) reserveCode(code string, telegramID int64, rawUrl string, lifeTime time.Duration) (models.Url, bool, error) {
+	valBytes, err := s.db.Get("urls", map[string]string{
+		"Hash": code,
+	})
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return models.Url{}, false, err
+	}
+
+	if err == nil {
+		var existing models.Url
+		if err := json.Unmarshal(valBytes, &existing); err != nil {
+			return models.Url{}, false, err
+		}
+		if existing.Url != rawUrl || existing.Telegram_id != telegramID || existing.Disabled {
+			return models.Url{}, true, nil
+		}
+		if !existing.IsExpired(time.Now()) {
+			return existing, false, nil
+		}
+		if _, err := s.db.Delete("urls", "Hash=eq."+code); err != nil {
+			return models.Url{}, false, err
+		}
+	}
+
+	userUuid, err := s.users.Resolve(telegramID)
+	if err != nil {
+		return models.Url{}, false, err
+	}
+
+	link := models.Url{User_uuid: userUuid, Telegram_id: telegramID, Hash: code, Url: rawUrl}
+	if lifeTime > 0 {
+		expiresAt := time.Now().Add(lifeTime).UTC()
+		link.Expires_at = &expiresAt
+	}
+
+	creation, err := s.takeQuota(telegramID, code, time.Now())
+	if err != nil {
+		return models.Url{}, false, err
+	}
+
+	if _, err := s.db.Insert("urls", link); err != nil {
+		// a link that was not stored does not count against the quota
+		if _, releaseErr := s.db.Delete("link_creations", "uuid=eq."+creation); releaseErr != nil {
+			return models.Url{}, false, releaseErr
+		}
+		if errors.Is(err, database.ErrConflict) {
+			return models.Url{}, true, nil
+		}
+		return models.Url{}, false, err
+	}
+	// a deleted, expired or swept link may have left clicks under the code
+	if err := purgeActivity(s.db, code); err != nil {
+		return models.Url{}, false, err
+	}
+	return link, false, nil
+}
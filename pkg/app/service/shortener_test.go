@@ -0,0 +1,335 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"url-shorter-bot/pkg/analytics"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/cache"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/models"
+	"url-shorter-bot/pkg/users"
+)
+
+type sequenceGenerator struct {
+	codes []string
+}
+
+func (g *sequenceGenerator) Generate(seed string, attempt int) (string, error) {
+	return g.codes[attempt%len(g.codes)], nil
+}
+
+func newTestDB(t *testing.T) database.SupabaseClient {
+	t.Helper()
+	db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "links.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	return db
+}
+
+func newTestShortener(db database.SupabaseClient, gen shortcode.Generator, quota Quota) *ShortenerService {
+	return NewShortenerService(db, gen, quota, users.NewResolver(db, cache.NewMemoryCache(time.Minute, time.Minute)))
+}
+
+func TestShortenerService_CreateLink(t *testing.T) {
+	tests := []struct {
+		name         string
+		codes        []string
+		existing     []models.Url
+		expectedCode string
+		expectErr    bool
+	}{
+		{
+			name:         "free code",
+			codes:        []string{"aaa"},
+			expectedCode: "aaa",
+		},
+		{
+			name:         "collision with another link retries",
+			codes:        []string{"aaa", "bbb"},
+			existing:     []models.Url{{Telegram_id: 2, Hash: "aaa", Url: "https://someone-else.com"}},
+			expectedCode: "bbb",
+		},
+		{
+			name:         "same link is reused",
+			codes:        []string{"aaa", "bbb"},
+			existing:     []models.Url{{Telegram_id: 1, Hash: "aaa", Url: "https://valid.com"}},
+			expectedCode: "aaa",
+		},
+		{
+			name:         "disabled same link is not reused",
+			codes:        []string{"aaa", "bbb"},
+			existing:     []models.Url{{Telegram_id: 1, Hash: "aaa", Url: "https://valid.com", Disabled: true}},
+			expectedCode: "bbb",
+		},
+		{
+			name:      "every attempt collides",
+			codes:     []string{"aaa"},
+			existing:  []models.Url{{Telegram_id: 2, Hash: "aaa", Url: "https://someone-else.com"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			for _, link := range tt.existing {
+				if _, err := db.Insert("urls", link); err != nil {
+					t.Fatalf("failed to seed link: %v", err)
+				}
+			}
+			shortener := newTestShortener(db, &sequenceGenerator{codes: tt.codes}, Quota{})
+
+			link, err := shortener.Shorten(1, models.RequestData{Url: "https://valid.com"})
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error = %v, got %v", tt.expectErr, err)
+			}
+			if link.Hash != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, link.Hash)
+			}
+			if !tt.expectErr && (link.Url != "https://valid.com" || link.Telegram_id != 1) {
+				t.Errorf("unexpected link %+v", link)
+			}
+		})
+	}
+}
+
+func TestShortenerService_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       models.RequestData
+		quota     Quota
+		created   int
+		expectErr error
+	}{
+		{name: "valid", req: models.RequestData{Url: "https://valid.com", Alias: "Spring-Sale"}},
+		{name: "invalid url", req: models.RequestData{Url: "valid.com"}, expectErr: ErrInvalidURL},
+		{name: "invalid life time", req: models.RequestData{Url: "https://valid.com", LifeTime: "soon"}, expectErr: ErrInvalidLifeTime},
+		{name: "reserved alias", req: models.RequestData{Url: "https://valid.com", Alias: "api"}, expectErr: ErrInvalidAlias},
+		{name: "taken alias", req: models.RequestData{Url: "https://valid.com", Alias: "taken"}, expectErr: ErrAliasTaken},
+		{name: "under the quota", req: models.RequestData{Url: "https://valid.com"}, quota: Quota{PerMinute: 3, PerDay: 10}, created: 2},
+		{name: "minute quota", req: models.RequestData{Url: "https://valid.com"}, quota: Quota{PerMinute: 3}, created: 3, expectErr: ErrQuotaExceeded},
+		{name: "day quota", req: models.RequestData{Url: "https://valid.com"}, quota: Quota{PerMinute: 10, PerDay: 2}, created: 2, expectErr: ErrQuotaExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if _, err := db.Insert("urls", models.Url{Telegram_id: 2, Hash: "taken", Url: "https://someone-else.com"}); err != nil {
+				t.Fatalf("failed to seed link: %v", err)
+			}
+			for i := 0; i < tt.created; i++ {
+				if _, err := db.Insert("link_creations", models.LinkCreation{Telegram_id: 1, Hash: fmt.Sprintf("old%d", i)}); err != nil {
+					t.Fatalf("failed to seed creation: %v", err)
+				}
+			}
+			shortener := newTestShortener(db, &sequenceGenerator{codes: []string{"new"}}, tt.quota)
+
+			_, err := shortener.Shorten(1, tt.req)
+			if !errors.Is(err, tt.expectErr) {
+				t.Errorf("expected error %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestShortenerService_QuotaAfterDelete(t *testing.T) {
+	db := newTestDB(t)
+	shortener := newTestShortener(db, &sequenceGenerator{codes: []string{"aaa", "bbb", "ccc"}}, Quota{PerDay: 2})
+
+	for i := 0; i < 2; i++ {
+		link, err := shortener.Shorten(1, models.RequestData{Url: fmt.Sprintf("https://valid.com/%d", i)})
+		if err != nil {
+			t.Fatalf("failed to shorten: %v", err)
+		}
+		if _, err := db.Delete("urls", "Hash=eq."+link.Hash); err != nil {
+			t.Fatalf("failed to delete link: %v", err)
+		}
+	}
+
+	if _, err := shortener.Shorten(1, models.RequestData{Url: "https://valid.com/2"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected deleted links to keep counting, got %v", err)
+	}
+}
+
+func TestShortenerService_QuotaConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	generator, err := shortcode.NewGenerator("random", "", 0)
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+	shortener := newTestShortener(db, generator, Quota{PerMinute: 3})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := shortener.Shorten(1, models.RequestData{Url: fmt.Sprintf("https://valid.com/%d", i)})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrQuotaExceeded):
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if created != 3 {
+		t.Errorf("expected 3 links within the quota, got %d", created)
+	}
+	if count, err := db.Count("link_creations", "Telegram_id=eq.1"); err != nil || count != 3 {
+		t.Errorf("expected 3 recorded creations, got %d (%v)", count, err)
+	}
+}
+
+// racingDB reports every new link as stored in between by someone else.
+type racingDB struct {
+	database.SupabaseClient
+}
+
+func (db racingDB) Insert(table string, data interface{}) ([]byte, error) {
+	if table == "urls" {
+		return nil, database.ErrConflict
+	}
+	return db.SupabaseClient.Insert(table, data)
+}
+
+func TestShortenerService_TakenCodeKeepsQuota(t *testing.T) {
+	db := newTestDB(t)
+	shortener := newTestShortener(racingDB{db}, &sequenceGenerator{codes: []string{"new"}}, Quota{PerMinute: 1})
+
+	if _, err := shortener.Shorten(1, models.RequestData{Url: "https://valid.com", Alias: "taken"}); !errors.Is(err, ErrAliasTaken) {
+		t.Fatalf("expected the alias to be taken, got %v", err)
+	}
+	if count, err := db.Count("link_creations", "Telegram_id=eq.1"); err != nil || count != 0 {
+		t.Errorf("expected a taken code to give the quota back, got %d creations (%v)", count, err)
+	}
+}
+
+func TestShortenerService_LinksUser(t *testing.T) {
+	db := newTestDB(t)
+	shortener := newTestShortener(db, &sequenceGenerator{codes: []string{"aaa"}}, Quota{})
+
+	link, err := shortener.Shorten(1, models.RequestData{Url: "https://valid.com"})
+	if err != nil {
+		t.Fatalf("failed to shorten: %v", err)
+	}
+
+	body, err := db.Get("users_info", map[string]string{"Telegram_id": "1"})
+	if err != nil {
+		t.Fatalf("expected the user row to be created: %v", err)
+	}
+	var user models.Users
+	if err := json.Unmarshal(body, &user); err != nil {
+		t.Fatalf("failed to decode user: %v", err)
+	}
+	if user.Uuid == "" || link.User_uuid != user.Uuid {
+		t.Errorf("expected link of user %q, got %q", user.Uuid, link.User_uuid)
+	}
+}
+
+func TestShortenerService_ReusedCode(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		expiry *time.Time
+		remove func(db database.SupabaseClient, links *LinkService) error
+	}{
+		{name: "deleted by the owner", remove: func(db database.SupabaseClient, links *LinkService) error {
+			return links.Delete(1, "sale")
+		}},
+		{name: "expired", expiry: &past, remove: func(db database.SupabaseClient, links *LinkService) error {
+			return nil
+		}},
+		{name: "swept", remove: func(db database.SupabaseClient, links *LinkService) error {
+			_, err := db.Delete("urls", "Hash=eq.sale")
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if _, err := db.Insert("urls", models.Url{Telegram_id: 1, Hash: "sale", Url: "https://old.com", Expires_at: tt.expiry}); err != nil {
+				t.Fatalf("failed to seed link: %v", err)
+			}
+			db.Insert("clicks", models.Click{Hash: "sale", Ip_hash: "a", Referrer: "https://t.me/old", Created_at: time.Now()})
+			db.Insert("url_history", models.UrlHistory{Telegram_id: 1, Hash: "sale", Old_url: "https://older.com", New_url: "https://old.com"})
+
+			if err := tt.remove(db, NewLinkService(db, cache.NewMemoryCache(time.Minute, time.Minute))); err != nil {
+				t.Fatalf("failed to remove the link: %v", err)
+			}
+
+			shortener := newTestShortener(db, &sequenceGenerator{codes: []string{"unused"}}, Quota{})
+			if _, err := shortener.Shorten(1, models.RequestData{Url: "https://old.com", Alias: "sale"}); err != nil {
+				t.Fatalf("failed to reuse the alias: %v", err)
+			}
+
+			stats, err := analytics.NewReporter(db).LinkStats("sale", 30)
+			if err != nil {
+				t.Fatalf("failed to load stats: %v", err)
+			}
+			if stats.TotalClicks != 0 || stats.UniqueVisitors != 0 || stats.LastClick != nil || len(stats.Referrers) != 0 {
+				t.Errorf("expected empty stats for the new link, got %+v", stats)
+			}
+			if history, _ := db.Count("url_history", "Hash=eq.sale"); history != 0 {
+				t.Errorf("expected no history for the new link, got %d rows", history)
+			}
+		})
+	}
+}
+
+// staleReads misses every link on Get, like a lookup that ran just before
+// another request stored the same code.
+type staleReads struct {
+	database.SupabaseClient
+}
+
+func (s staleReads) Get(table string, target map[string]string) ([]byte, error) {
+	return nil, database.ErrNotFound
+}
+
+func TestShortenerService_ConcurrentCode(t *testing.T) {
+	tests := []struct {
+		name         string
+		alias        string
+		expectedCode string
+		expectErr    error
+	}{
+		{name: "generated code is regenerated", expectedCode: "bbb"},
+		{name: "alias is taken", alias: "aaa", expectErr: ErrAliasTaken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			if _, err := db.Insert("urls", models.Url{Telegram_id: 2, Hash: "aaa", Url: "https://someone-else.com"}); err != nil {
+				t.Fatalf("failed to seed link: %v", err)
+			}
+			shortener := newTestShortener(staleReads{db}, &sequenceGenerator{codes: []string{"aaa", "bbb"}}, Quota{})
+
+			link, err := shortener.Shorten(1, models.RequestData{Url: "https://valid.com", Alias: tt.alias})
+			if !errors.Is(err, tt.expectErr) {
+				t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+			}
+			if link.Hash != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, link.Hash)
+			}
+		})
+	}
+}
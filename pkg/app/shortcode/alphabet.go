@@ -0,0 +1,71 @@
+package shortcode
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"url-shorter-bot/pkg/models"
+)
+
+// ambiguousCharacters are easy to confuse when a link is read aloud or re-typed.
+const ambiguousCharacters = "0Oo1lI"
+
+// aliasCharacters are accepted in custom aliases besides the code alphabet.
+const aliasCharacters = DefaultAlphabet + "-_"
+
+// Alphabet prepares the configured alphabet: lower-cased when codes are
+// case-insensitive and without look-alike characters when excludeAmbiguous is set.
+func Alphabet(alphabet string, caseInsensitive, excludeAmbiguous bool) string {
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	if caseInsensitive {
+		alphabet = strings.ToLower(alphabet)
+	}
+
+	var b strings.Builder
+	for _, r := range alphabet {
+		if excludeAmbiguous && strings.ContainsRune(ambiguousCharacters, r) {
+			continue
+		}
+		if strings.ContainsRune(b.String(), r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// RoutePattern returns the mux path variable matching codes built from
+// alphabet and custom aliases. Digits are always accepted, so legacy numeric
+// hashes keep resolving.
+func RoutePattern(alphabet string, caseInsensitive bool) string {
+	characters := alphabet + aliasCharacters
+	if caseInsensitive {
+		characters += strings.ToUpper(alphabet)
+	}
+
+	var class strings.Builder
+	for _, r := range characters {
+		if strings.ContainsRune(class.String(), r) {
+			continue
+		}
+		class.WriteRune(r)
+	}
+
+	escaped := strings.NewReplacer(`-`, `\-`, `.`, `\.`).Replace(class.String())
+	return "{url:[" + escaped + "]+}"
+}
+
+// Normalize maps a requested code onto the form it is stored under.
+func Normalize(code string, caseInsensitive bool) string {
+	if caseInsensitive {
+		return strings.ToLower(code)
+	}
+	return code
+}
+
+// Link builds the public short URL for code.
+func Link(code string) string {
+	return fmt.Sprintf("%s://%s%s/%s", models.Protocol, models.Config.HostName, models.PortForUrl, url.PathEscape(code))
+}
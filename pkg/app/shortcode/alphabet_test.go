@@ -0,0 +1,96 @@
+package shortcode
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAlphabet(t *testing.T) {
+	tests := []struct {
+		name             string
+		alphabet         string
+		caseInsensitive  bool
+		excludeAmbiguous bool
+		expected         string
+	}{
+		{name: "default", expected: DefaultAlphabet},
+		{name: "case insensitive", alphabet: "abcABC123", caseInsensitive: true, expected: "abc123"},
+		{name: "exclude ambiguous", alphabet: "0O1lIab", excludeAmbiguous: true, expected: "ab"},
+		{
+			name:             "default case insensitive without ambiguous",
+			caseInsensitive:  true,
+			excludeAmbiguous: true,
+			expected:         "23456789abcdefghijkmnpqrstuvwxyz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Alphabet(tt.alphabet, tt.caseInsensitive, tt.excludeAmbiguous)
+			if got != tt.expected {
+				t.Errorf("Alphabet() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	tests := []struct {
+		name            string
+		alphabet        string
+		caseInsensitive bool
+		matches         []string
+		rejects         []string
+	}{
+		{
+			name:     "base62 with legacy hashes and aliases",
+			alphabet: DefaultAlphabet,
+			matches:  []string{"aZ3x9Qk", "128429213", "spring-sale", "promo_2025"},
+			rejects:  []string{"short/x", "a b"},
+		},
+		{
+			name:            "case insensitive accepts upper case",
+			alphabet:        "abcdef",
+			caseInsensitive: true,
+			matches:         []string{"abc", "ABC", "4294967295"},
+			rejects:         []string{"a~b"},
+		},
+		{
+			name:     "dash and dot are literal",
+			alphabet: "ab-.",
+			matches:  []string{"a-b.a"},
+			rejects:  []string{"a,b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern := RoutePattern(tt.alphabet, tt.caseInsensitive)
+			if !strings.HasPrefix(pattern, "{url:") {
+				t.Fatalf("unexpected pattern %q", pattern)
+			}
+			re := regexp.MustCompile("^" + strings.TrimSuffix(strings.TrimPrefix(pattern, "{url:"), "}") + "$")
+
+			for _, code := range tt.matches {
+				if !re.MatchString(code) {
+					t.Errorf("pattern %q should match %q", pattern, code)
+				}
+			}
+			for _, code := range tt.rejects {
+				if re.MatchString(code) {
+					t.Errorf("pattern %q should not match %q", pattern, code)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := Normalize("AbC", true); got != "abc" {
+		t.Errorf("expected lower-cased code, got %q", got)
+	}
+	if got := Normalize("AbC", false); got != "AbC" {
+		t.Errorf("expected code unchanged, got %q", got)
+	}
+}
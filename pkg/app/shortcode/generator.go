@@ -0,0 +1,156 @@
+package shortcode
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"url-shorter-bot/pkg/app/validators"
+)
+
+const DefaultAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const DefaultLength = 7
+
+// urlSafeCharacters are the unreserved characters of RFC 3986 except "~".
+const urlSafeCharacters = DefaultAlphabet + "-_."
+
+// MaxAttempts bounds how many codes are tried before giving up on collisions.
+const MaxAttempts = 5
+
+type Generator interface {
+	// Generate returns a candidate code for seed. attempt starts at zero and
+	// grows every time the previous candidate collided with an existing link.
+	Generate(seed string, attempt int) (string, error)
+}
+
+// NewGenerator builds the generator named by kind: "random", "counter" or "legacy".
+func NewGenerator(kind, alphabet string, length int) (Generator, error) {
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	if length <= 0 {
+		length = DefaultLength
+	}
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "", "random":
+		return &randomGenerator{alphabet: alphabet, length: length}, nil
+	case "counter":
+		return newCounterGenerator(alphabet, length, uint64(time.Now().UnixNano()))
+	case "legacy":
+		return legacyGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown code generator: %s", kind)
+	}
+}
+
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return errors.New("code alphabet must have at least 2 characters")
+	}
+
+	seen := map[rune]bool{}
+	for _, r := range alphabet {
+		if !strings.ContainsRune(urlSafeCharacters, r) || seen[r] {
+			return fmt.Errorf("code alphabet must be unique URL-safe characters, got %q", r)
+		}
+		seen[r] = true
+	}
+	return nil
+}
+
+// randomGenerator draws every character uniformly from the alphabet.
+type randomGenerator struct {
+	alphabet string
+	length   int
+}
+
+func (g *randomGenerator) Generate(seed string, attempt int) (string, error) {
+	// reject bytes above the largest multiple of len(alphabet) to avoid modulo bias
+	limit := 256 - 256%len(g.alphabet)
+	code := make([]byte, 0, g.length)
+	buf := make([]byte, g.length)
+
+	for len(code) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(code) < g.length {
+				code = append(code, g.alphabet[int(b)%len(g.alphabet)])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// counterGenerator hands out sequential numbers scrambled by a multiplicative
+// permutation of the code space, so consecutive links do not look consecutive.
+type counterGenerator struct {
+	alphabet   string
+	length     int
+	space      uint64
+	multiplier uint64
+	counter    atomic.Uint64
+}
+
+func newCounterGenerator(alphabet string, length int, start uint64) (*counterGenerator, error) {
+	space := uint64(1)
+	for i := 0; i < length; i++ {
+		hi, lo := bits.Mul64(space, uint64(len(alphabet)))
+		if hi != 0 {
+			return nil, fmt.Errorf("code length %d is too long for the counter generator", length)
+		}
+		space = lo
+	}
+
+	multiplier := uint64(1580030173) % space
+	for gcd(multiplier, space) != 1 {
+		multiplier++
+	}
+
+	g := &counterGenerator{alphabet: alphabet, length: length, space: space, multiplier: multiplier}
+	g.counter.Store(start % space)
+	return g, nil
+}
+
+func (g *counterGenerator) Generate(seed string, attempt int) (string, error) {
+	n := g.counter.Add(1) % g.space
+
+	hi, lo := bits.Mul64(n, g.multiplier)
+	_, n = bits.Div64(hi, lo, g.space)
+
+	code := make([]byte, g.length)
+	base := uint64(len(g.alphabet))
+	for i := g.length - 1; i >= 0; i-- {
+		code[i] = g.alphabet[n%base]
+		n /= base
+	}
+	return string(code), nil
+}
+
+// legacyGenerator keeps the original decimal FNV-1a codes. Retries salt the
+// seed with the attempt number so a collision yields a different code.
+type legacyGenerator struct{}
+
+func (legacyGenerator) Generate(seed string, attempt int) (string, error) {
+	if attempt > 0 {
+		seed += "#" + strconv.Itoa(attempt)
+	}
+	return strconv.Itoa(int(validators.ShortToHash(seed))), nil
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,86 @@
+package shortcode
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"url-shorter-bot/pkg/app/validators"
+)
+
+func TestNewGenerator(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      string
+		alphabet  string
+		length    int
+		expectErr bool
+	}{
+		{name: "default random", kind: ""},
+		{name: "random", kind: "random", alphabet: "abc", length: 5},
+		{name: "counter", kind: "counter", length: 8},
+		{name: "legacy", kind: "legacy"},
+		{name: "unknown kind", kind: "uuid", expectErr: true},
+		{name: "alphabet too short", kind: "random", alphabet: "a", expectErr: true},
+		{name: "duplicate characters", kind: "random", alphabet: "abca", expectErr: true},
+		{name: "counter too long", kind: "counter", length: 20, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGenerator(tt.kind, tt.alphabet, tt.length)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("expected error = %v, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestRandomGenerator(t *testing.T) {
+	g, err := NewGenerator("random", "xyz", 12)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		code, err := g.Generate("ignored", i)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(code) != 12 || strings.Trim(code, "xyz") != "" {
+			t.Fatalf("unexpected code %q", code)
+		}
+	}
+}
+
+func TestCounterGenerator_UniqueOverWholeSpace(t *testing.T) {
+	g, err := newCounterGenerator("01", 4, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 16; i++ {
+		code, _ := g.Generate("", 0)
+		if len(code) != 4 {
+			t.Fatalf("unexpected code length %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestLegacyGenerator(t *testing.T) {
+	g, _ := NewGenerator("legacy", "", 0)
+
+	first, _ := g.Generate("https://example.com123", 0)
+	if first != strconv.Itoa(int(validators.ShortToHash("https://example.com123"))) {
+		t.Errorf("first attempt must match the legacy hash, got %s", first)
+	}
+
+	retry, _ := g.Generate("https://example.com123", 1)
+	if retry == first {
+		t.Errorf("retry must produce a different code, got %s twice", retry)
+	}
+}
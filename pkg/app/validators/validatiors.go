@@ -1,8 +1,13 @@
 package validators
 
 import (
+	"errors"
+	"fmt"
 	"hash/fnv"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func IsValidURL(url string) bool {
@@ -15,3 +20,67 @@ func ShortToHash(s string) uint32 {
 	h.Write([]byte(s))
 	return h.Sum32()
 }
+
+const (
+	MinAliasLength = 3
+	MaxAliasLength = 32
+)
+
+var aliasRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var digitsRe = regexp.MustCompile(`^[0-9]+$`)
+
+// ReservedAliases would shadow service routes if used as short codes.
+var ReservedAliases = map[string]bool{
+	"short":   true,
+	"api":     true,
+	"health":  true,
+	"healthz": true,
+	"readyz":  true,
+	"version": true,
+	"metrics": true,
+	"stats":   true,
+	"admin":   true,
+	"static":  true,
+	"webhook": true,
+}
+
+// ValidateAlias checks a custom short code chosen by the user.
+func ValidateAlias(alias string) error {
+	if len(alias) < MinAliasLength || len(alias) > MaxAliasLength {
+		return fmt.Errorf("alias must be %d-%d characters long", MinAliasLength, MaxAliasLength)
+	}
+	if !aliasRe.MatchString(alias) {
+		return errors.New("alias may contain only latin letters, digits, '-' and '_'")
+	}
+	if digitsRe.MatchString(alias) {
+		return errors.New("alias must not consist of digits only")
+	}
+	if ReservedAliases[strings.ToLower(alias)] {
+		return errors.New("alias is reserved: " + alias)
+	}
+	return nil
+}
+
+// ParseLifeTime parses a link life time such as "720h", "90m" or "30d".
+// An empty string means the link never expires and yields zero.
+func ParseLifeTime(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errors.New("invalid life time: " + s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.New("invalid life time: " + s)
+	}
+	return d, nil
+}
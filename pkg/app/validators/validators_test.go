@@ -1,6 +1,9 @@
 package validators
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestIsValidURL(t *testing.T) {
 	tests := []struct {
@@ -110,3 +113,59 @@ func TestShortToHash_Consistency(t *testing.T) {
 		}
 	}
 }
+
+func TestParseLifeTime(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  time.Duration
+		expectErr bool
+	}{
+		{name: "Empty means no expiry", input: "", expected: 0},
+		{name: "Hours", input: "720h", expected: 720 * time.Hour},
+		{name: "Minutes", input: "90m", expected: 90 * time.Minute},
+		{name: "Days", input: "30d", expected: 30 * 24 * time.Hour},
+		{name: "Zero days", input: "0d", expectErr: true},
+		{name: "Negative duration", input: "-1h", expectErr: true},
+		{name: "Garbage", input: "forever", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLifeTime(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ParseLifeTime(%q) error = %v, expectErr %v", tt.input, err, tt.expectErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseLifeTime(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expectErr bool
+	}{
+		{name: "Valid alias", input: "spring-sale", expectErr: false},
+		{name: "Underscore and digits", input: "promo_2025", expectErr: false},
+		{name: "Too short", input: "ab", expectErr: true},
+		{name: "Too long", input: "a-very-long-alias-that-nobody-can-type", expectErr: true},
+		{name: "Invalid characters", input: "spring sale", expectErr: true},
+		{name: "Non latin", input: "весна", expectErr: true},
+		{name: "Digits only", input: "12345", expectErr: true},
+		{name: "Reserved word", input: "short", expectErr: true},
+		{name: "Reserved word any case", input: "API", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAlias(tt.input)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("ValidateAlias(%q) error = %v, expectErr %v", tt.input, err, tt.expectErr)
+			}
+		})
+	}
+}
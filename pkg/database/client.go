@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -46,6 +47,52 @@ func (c *client) Get(table string, filters map[string]string) ([]byte, error) {
 	return handleResponse(resp, err)
 }
 
+func (c *client) Select(table string, query string) ([]byte, error) {
+	url := fmt.Sprintf("%s/rest/v1/%s", c.baseURL, table)
+	if query != "" {
+		url += "?" + query
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	c.setHeaders(req)
+
+	resp, err := c.client.Do(req)
+	return handleResponse(resp, err)
+}
+
+func (c *client) Count(table string, filter string) (int, error) {
+	url := fmt.Sprintf("%s/rest/v1/%s", c.baseURL, table)
+	if filter != "" {
+		url += "?" + filter
+	}
+
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	c.setHeaders(req)
+	req.Header.Set("Prefer", "count=exact")
+
+	resp, err := c.client.Do(req)
+	if _, err := handleResponse(resp, err); err != nil {
+		return 0, err
+	}
+
+	// Content-Range looks like "0-24/3573" or "*/0"
+	contentRange := resp.Header.Get("Content-Range")
+	_, total, ok := strings.Cut(contentRange, "/")
+	if !ok {
+		return 0, fmt.Errorf("missing count in Content-Range: %q", contentRange)
+	}
+	return strconv.Atoi(total)
+}
+
 func (c *client) Insert(table string, data interface{}) ([]byte, error) {
 	body, err := json.Marshal(data)
 	if err != nil {
@@ -61,6 +108,21 @@ func (c *client) Insert(table string, data interface{}) ([]byte, error) {
 	return handleResponse(resp, err)
 }
 
+func (c *client) Update(table string, filter string, data interface{}) ([]byte, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("%s/rest/v1/%s?%s", c.baseURL, table, filter), bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	c.setHeaders(req)
+	req.Header.Set("Prefer", "return=representation")
+	resp, err := c.client.Do(req)
+	return handleResponse(resp, err)
+}
+
 func (c *client) Delete(table string, filter string) ([]byte, error) {
 	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/rest/v1/%s?%s", c.baseURL, table, filter), nil)
 	if err != nil {
@@ -71,6 +133,20 @@ func (c *client) Delete(table string, filter string) ([]byte, error) {
 	return handleResponse(resp, err)
 }
 
+func (c *client) Rpc(function string, params interface{}) ([]byte, error) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/rest/v1/rpc/%s", c.baseURL, function), bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	c.setHeaders(req)
+	resp, err := c.client.Do(req)
+	return handleResponse(resp, err)
+}
+
 func (c *client) setHeaders(req *http.Request) {
 	req.Header.Set("apikey", c.apiKey)
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
@@ -83,6 +159,17 @@ func handleResponse(resp *http.Response, err error) ([]byte, error) {
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotAcceptable && strings.Contains(string(body), "contains 0 rows") {
+		return nil, fmt.Errorf("HTTP %d: %s: %w", resp.StatusCode, string(body), ErrNotFound)
+	}
+	// PostgREST answers unique violations (23505) with 409
+	if resp.StatusCode == http.StatusConflict {
+		return nil, fmt.Errorf("HTTP %d: %s: %w", resp.StatusCode, string(body), ErrConflict)
+	}
+	// PGRST205: not in the schema cache, 42P01: undefined table
+	if resp.StatusCode == http.StatusNotFound && (strings.Contains(string(body), "PGRST205") || strings.Contains(string(body), "42P01")) {
+		return nil, fmt.Errorf("HTTP %d: %s: %w", resp.StatusCode, string(body), ErrNoTable)
+	}
 	if resp.StatusCode >= 400 {
 		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
 	}
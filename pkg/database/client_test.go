@@ -2,6 +2,7 @@ package database
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -191,3 +192,162 @@ func TestClient_Delete_tableQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_Update(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch {
+			t.Errorf("expected PATCH, got %s", r.Method)
+		}
+		if r.URL.Path != "/rest/v1/urls" || r.URL.RawQuery != "Hash=eq.abc" {
+			t.Errorf("unexpected request %s?%s", r.URL.Path, r.URL.RawQuery)
+		}
+		if r.Header.Get("Prefer") != "return=representation" {
+			t.Errorf("expected representation, got Prefer %q", r.Header.Get("Prefer"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"Disabled":true}` {
+			t.Errorf("unexpected body %s", body)
+		}
+		w.Write([]byte(`[{"Hash":"abc","Disabled":true}]`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, "test-api-key")
+	resp, err := client.Update("urls", "Hash=eq.abc", map[string]bool{"Disabled": true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(resp) != `[{"Hash":"abc","Disabled":true}]` {
+		t.Errorf("unexpected response %q", string(resp))
+	}
+}
+
+func TestClient_Get_notFound(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotAcceptable)
+		w.Write([]byte(`{"code":"PGRST116","details":"The result contains 0 rows","message":"JSON object requested, multiple (or no) rows returned"}`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, "test-api-key")
+	_, err := client.Get("urls", map[string]string{"Hash": "1"})
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestClient_Insert_conflict(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"code":"23505","message":"duplicate key value violates unique constraint \"urls_hash_key\""}`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, "test-api-key")
+	_, err := client.Insert("urls", map[string]string{"Hash": "1"})
+
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+}
+
+func TestClient_Select_noTable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"PGRST205","message":"Could not find the table 'public.schema_migrations' in the schema cache"}`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, "test-api-key")
+	_, err := client.Select("schema_migrations", "order=version.asc")
+
+	if !errors.Is(err, ErrNoTable) {
+		t.Errorf("expected ErrNoTable, got %v", err)
+	}
+}
+
+func TestClient_Rpc(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.URL.Path != "/rest/v1/rpc/take_rate_limit_hit" || string(body) != `{"hit_key":"abc"}` {
+			t.Errorf("unexpected request %s %s %s", r.Method, r.URL.Path, body)
+		}
+		w.Write([]byte(`[{"allowed":true}]`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, "test-api-key")
+	body, err := client.Rpc("take_rate_limit_hit", map[string]string{"hit_key": "abc"})
+	if err != nil || string(body) != `[{"allowed":true}]` {
+		t.Errorf("unexpected result %s (%v)", body, err)
+	}
+}
+
+func TestClient_Select_tableQuery(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/v1/clicks" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if r.URL.RawQuery != "Hash=eq.abc&order=created_at.desc" {
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+		if r.Header.Get("Accept") != "application/json" {
+			t.Errorf("expected array response, got Accept %q", r.Header.Get("Accept"))
+		}
+		w.Write([]byte(`[{"Hash":"abc"}]`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, "test-api-key")
+	resp, err := client.Select("clicks", "Hash=eq.abc&order=created_at.desc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(resp) != `[{"Hash":"abc"}]` {
+		t.Errorf("unexpected response %q", string(resp))
+	}
+}
+
+func TestClient_Count(t *testing.T) {
+	tests := []struct {
+		name         string
+		contentRange string
+		statusCode   int
+		expected     int
+		expectErr    bool
+	}{
+		{name: "rows found", contentRange: "0-24/3573", statusCode: http.StatusOK, expected: 3573},
+		{name: "no rows", contentRange: "*/0", statusCode: http.StatusOK, expected: 0},
+		{name: "missing header", statusCode: http.StatusOK, expectErr: true},
+		{name: "server error", contentRange: "*/0", statusCode: http.StatusInternalServerError, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodHead {
+					t.Errorf("expected HEAD, got %s", r.Method)
+				}
+				if r.Header.Get("Prefer") != "count=exact" {
+					t.Errorf("expected exact count, got Prefer %q", r.Header.Get("Prefer"))
+				}
+				if tt.contentRange != "" {
+					w.Header().Set("Content-Range", tt.contentRange)
+				}
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer ts.Close()
+
+			client := NewClient(ts.URL, "test-api-key")
+			count, err := client.Count("clicks", "Hash=eq.abc")
+
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error = %v, got %v", tt.expectErr, err)
+			}
+			if count != tt.expected {
+				t.Errorf("expected count %d, got %d", tt.expected, count)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// condition is a single PostgREST horizontal filter such as Hash=eq.123.
+type condition struct {
+	column   string
+	operator string
+	value    string
+	or       []condition // set for or=(...), which holds when any of them does
+}
+
+// order is a PostgREST ordering term such as created_at.desc.
+type order struct {
+	column     string
+	descending bool
+}
+
+// query is a parsed PostgREST query string.
+type query struct {
+	conditions []condition
+	columns    []string
+	order      []order
+	limit      int
+	offset     int
+}
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var sqlOperators = map[string]string{
+	"eq":  "=",
+	"neq": "<>",
+	"lt":  "<",
+	"lte": "<=",
+	"gt":  ">",
+	"gte": ">=",
+	// PostgREST's ilike uses * as wildcard, whereClause turns it into %
+	"ilike": "LIKE",
+}
+
+func isIdentifier(name string) bool {
+	return identifierRe.MatchString(name)
+}
+
+// parseQuery parses the PostgREST query syntax accepted by Select and Delete,
+// e.g. "Hash=eq.123&created_at=gte.2025-01-01T00:00:00Z&order=created_at.desc&limit=10".
+func parseQuery(raw string) (query, error) {
+	q := query{conditions: []condition{}}
+	if raw == "" {
+		return q, nil
+	}
+
+	for _, part := range strings.Split(raw, "&") {
+		column, expr, ok := strings.Cut(part, "=")
+		if !ok {
+			return q, fmt.Errorf("invalid filter: %s", part)
+		}
+
+		column, err := url.QueryUnescape(column)
+		if err != nil {
+			return q, err
+		}
+		expr, err = url.QueryUnescape(expr)
+		if err != nil {
+			return q, err
+		}
+
+		switch column {
+		case "select":
+			for _, c := range strings.Split(expr, ",") {
+				if c != "*" && !isIdentifier(c) {
+					return q, fmt.Errorf("invalid select column: %s", c)
+				}
+				q.columns = append(q.columns, c)
+			}
+			continue
+		case "order":
+			for _, term := range strings.Split(expr, ",") {
+				name, direction, _ := strings.Cut(term, ".")
+				if !isIdentifier(name) || (direction != "" && direction != "asc" && direction != "desc") {
+					return q, fmt.Errorf("invalid order: %s", term)
+				}
+				q.order = append(q.order, order{column: name, descending: direction == "desc"})
+			}
+			continue
+		case "or":
+			inner, ok := strings.CutPrefix(expr, "(")
+			inner, ok2 := strings.CutSuffix(inner, ")")
+			if !ok || !ok2 {
+				return q, fmt.Errorf("invalid or filter: %s", expr)
+			}
+			cond := condition{operator: "or"}
+			for _, term := range strings.Split(inner, ",") {
+				column, expr, _ := strings.Cut(term, ".")
+				sub, err := parseCondition(column, expr)
+				if err != nil {
+					return q, err
+				}
+				cond.or = append(cond.or, sub)
+			}
+			q.conditions = append(q.conditions, cond)
+			continue
+		case "limit", "offset":
+			n, err := strconv.Atoi(expr)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("invalid %s: %s", column, expr)
+			}
+			if column == "limit" {
+				q.limit = n
+			} else {
+				q.offset = n
+			}
+			continue
+		}
+
+		cond, err := parseCondition(column, expr)
+		if err != nil {
+			return q, err
+		}
+		q.conditions = append(q.conditions, cond)
+	}
+	return q, nil
+}
+
+// parseCondition parses the filter expr on column, e.g. eq.123.
+func parseCondition(column, expr string) (condition, error) {
+	operator, value, ok := strings.Cut(expr, ".")
+	if !ok || !isIdentifier(column) {
+		return condition{}, fmt.Errorf("invalid filter: %s=%s", column, expr)
+	}
+	if _, known := sqlOperators[operator]; !known && operator != "is" && operator != "in" {
+		return condition{}, fmt.Errorf("unsupported filter operator: %s", operator)
+	}
+	return condition{column: column, operator: operator, value: value}, nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"time"
+	"url-shorter-bot/pkg/metrics"
+)
+
+type instrumented struct {
+	next SupabaseClient
+}
+
+// Instrument records the latency and errors of every request to next in
+// the metrics registry. A Get without rows and a conflicting insert are not
+// errors.
+func Instrument(next SupabaseClient) SupabaseClient {
+	return &instrumented{next: next}
+}
+
+func observe(table, method string, start time.Time, err error) {
+	metrics.DatabaseDuration.Observe(time.Since(start).Seconds(), table, method)
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrConflict) {
+		metrics.DatabaseErrors.Inc(table, method)
+	}
+}
+
+func (c *instrumented) Get(table string, data map[string]string) ([]byte, error) {
+	start := time.Now()
+	body, err := c.next.Get(table, data)
+	observe(table, "get", start, err)
+	return body, err
+}
+
+func (c *instrumented) Select(table string, query string) ([]byte, error) {
+	start := time.Now()
+	body, err := c.next.Select(table, query)
+	observe(table, "select", start, err)
+	return body, err
+}
+
+func (c *instrumented) Count(table string, filter string) (int, error) {
+	start := time.Now()
+	count, err := c.next.Count(table, filter)
+	observe(table, "count", start, err)
+	return count, err
+}
+
+func (c *instrumented) Insert(table string, data interface{}) ([]byte, error) {
+	start := time.Now()
+	body, err := c.next.Insert(table, data)
+	observe(table, "insert", start, err)
+	return body, err
+}
+
+func (c *instrumented) Update(table string, filter string, data interface{}) ([]byte, error) {
+	start := time.Now()
+	body, err := c.next.Update(table, filter, data)
+	observe(table, "update", start, err)
+	return body, err
+}
+
+func (c *instrumented) Delete(table string, filter string) ([]byte, error) {
+	start := time.Now()
+	body, err := c.next.Delete(table, filter)
+	observe(table, "delete", start, err)
+	return body, err
+}
+
+func (c *instrumented) Rpc(function string, params interface{}) ([]byte, error) {
+	start := time.Now()
+	body, err := c.next.Rpc(function, params)
+	observe(function, "rpc", start, err)
+	return body, err
+}
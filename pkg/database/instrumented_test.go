@@ -0,0 +1,43 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"url-shorter-bot/pkg/metrics"
+)
+
+type failingClient struct {
+	SupabaseClient
+	err error
+}
+
+func (c *failingClient) Get(table string, data map[string]string) ([]byte, error) {
+	return nil, c.err
+}
+
+func TestInstrument_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		table       string
+		err         error
+		expectCount float64
+	}{
+		{name: "success", table: "instrument_ok"},
+		{name: "not found", table: "instrument_missing", err: ErrNotFound},
+		{name: "conflict", table: "instrument_conflict", err: ErrConflict},
+		{name: "failure", table: "instrument_failed", err: errors.New("boom"), expectCount: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := Instrument(&failingClient{err: tt.err})
+
+			if _, err := client.Get(tt.table, map[string]string{"Hash": "abc"}); err != tt.err {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+			if got := metrics.DatabaseErrors.Value(tt.table, "get"); got != tt.expectCount {
+				t.Errorf("expected %v errors, got %v", tt.expectCount, got)
+			}
+		})
+	}
+}
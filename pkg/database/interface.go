@@ -1,7 +1,30 @@
 package database
 
+import "errors"
+
+var (
+	// ErrNotFound is returned by Get when no row matches the filters.
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict is returned by Insert and Update when a row would violate
+	// a unique constraint.
+	ErrConflict = errors.New("record already exists")
+	// ErrNoTable is returned when the table does not exist (yet).
+	ErrNoTable = errors.New("table does not exist")
+)
+
 type SupabaseClient interface {
 	Get(table string, data map[string]string) ([]byte, error)
+	// Select returns a JSON array of the rows matching a PostgREST query
+	// such as "Telegram_id=eq.1&order=created_at.desc&limit=10".
+	Select(table string, query string) ([]byte, error)
+	// Count returns the number of rows matching a PostgREST filter.
+	Count(table string, filter string) (int, error)
 	Insert(table string, data interface{}) ([]byte, error)
+	// Update sets the fields of data on the rows matching a PostgREST filter
+	// and returns the updated rows as a JSON array.
+	Update(table string, filter string, data interface{}) ([]byte, error)
 	Delete(table string, filter string) ([]byte, error)
+	// Rpc calls the database function with the named params and returns its
+	// result as JSON, an array for functions returning a table.
+	Rpc(function string, params interface{}) ([]byte, error)
 }
@@ -0,0 +1,445 @@
+package database
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"url-shorter-bot/pkg/models"
+
+	_ "modernc.org/sqlite"
+)
+
+// timeLayout keeps stored timestamps lexicographically ordered.
+const timeLayout = "2006-01-02T15:04:05.000Z"
+
+type sqliteClient struct {
+	db *sql.DB
+}
+
+// NewSqliteClient opens (or creates) an embedded database at path and
+// creates the tables from models.SqliteRequests in the order of models.Tables.
+func NewSqliteClient(path string) (SupabaseClient, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	for _, table := range models.Tables {
+		if _, err := db.Exec(models.SqliteRequests[table]); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create table %s: %w", table, err)
+		}
+	}
+
+	return &sqliteClient{db: db}, nil
+}
+
+func (c *sqliteClient) Get(table string, filters map[string]string) ([]byte, error) {
+	if !isIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	conditions := []condition{}
+	for k, v := range filters {
+		if !isIdentifier(k) {
+			return nil, fmt.Errorf("invalid column name: %s", k)
+		}
+		conditions = append(conditions, condition{column: k, operator: "eq", value: v})
+	}
+
+	where, args := whereClause(conditions)
+	rows, err := c.query(fmt.Sprintf(`SELECT * FROM %s%s LIMIT 2`, table, where), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(rows) {
+	case 0:
+		return nil, fmt.Errorf("no record found in %s: %w", table, ErrNotFound)
+	case 1:
+		return json.Marshal(rows[0])
+	default:
+		return nil, fmt.Errorf("multiple records found in %s", table)
+	}
+}
+
+func (c *sqliteClient) Insert(table string, data interface{}) ([]byte, error) {
+	if !isIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	records, err := toRecords(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := []string{}
+	for _, record := range records {
+		if _, ok := record["uuid"]; !ok {
+			uuid, err := newUUID()
+			if err != nil {
+				return nil, err
+			}
+			record["uuid"] = uuid
+		}
+
+		columns := []string{}
+		placeholders := []string{}
+		args := []interface{}{}
+		for column, value := range record {
+			if !isIdentifier(column) {
+				return nil, fmt.Errorf("invalid column name: %s", column)
+			}
+			columns = append(columns, `"`+column+`"`)
+			placeholders = append(placeholders, "?")
+			args = append(args, toSqlValue(value))
+		}
+
+		query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+		if _, err := tx.Exec(query, args...); err != nil {
+			return nil, conflict(err)
+		}
+		ids = append(ids, fmt.Sprint(record["uuid"]))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	where, args := whereClause([]condition{{column: "uuid", operator: "in", value: "(" + strings.Join(ids, ",") + ")"}})
+	rows, err := c.query(fmt.Sprintf(`SELECT * FROM %s%s`, table, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rows)
+}
+
+func (c *sqliteClient) Select(table string, rawQuery string) ([]byte, error) {
+	if !isIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	q, err := parseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := "*"
+	if len(q.columns) > 0 && q.columns[0] != "*" {
+		quoted := make([]string, len(q.columns))
+		for i, c := range q.columns {
+			quoted[i] = `"` + c + `"`
+		}
+		columns = strings.Join(quoted, ", ")
+	}
+
+	where, args := whereClause(q.conditions)
+	statement := fmt.Sprintf(`SELECT %s FROM %s%s`, columns, table, where)
+
+	if len(q.order) > 0 {
+		terms := make([]string, len(q.order))
+		for i, o := range q.order {
+			terms[i] = `"` + o.column + `"`
+			if o.descending {
+				terms[i] += " DESC"
+			}
+		}
+		statement += " ORDER BY " + strings.Join(terms, ", ")
+	}
+	if q.limit > 0 || q.offset > 0 {
+		limit := q.limit
+		if limit == 0 {
+			limit = -1
+		}
+		statement += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, q.offset)
+	}
+
+	rows, err := c.query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rows)
+}
+
+func (c *sqliteClient) Count(table string, filter string) (int, error) {
+	if !isIdentifier(table) {
+		return 0, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	q, err := parseQuery(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	where, args := whereClause(q.conditions)
+
+	var count int
+	err = c.db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM %s%s`, table, where), args...).Scan(&count)
+	return count, err
+}
+
+func (c *sqliteClient) Update(table string, filter string, data interface{}) ([]byte, error) {
+	if !isIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	q, err := parseQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.conditions) == 0 {
+		return nil, errors.New("update requires a filter")
+	}
+
+	records, err := toRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != 1 || len(records[0]) == 0 {
+		return nil, errors.New("update requires a single object with at least one field")
+	}
+
+	assignments := []string{}
+	args := []interface{}{}
+	for column, value := range records[0] {
+		if !isIdentifier(column) {
+			return nil, fmt.Errorf("invalid column name: %s", column)
+		}
+		assignments = append(assignments, `"`+column+`" = ?`)
+		args = append(args, toSqlValue(value))
+	}
+
+	where, whereArgs := whereClause(q.conditions)
+	rows, err := c.query(fmt.Sprintf(`UPDATE %s SET %s%s RETURNING *`, table, strings.Join(assignments, ", "), where), append(args, whereArgs...)...)
+	if err != nil {
+		return nil, conflict(err)
+	}
+	return json.Marshal(rows)
+}
+
+func (c *sqliteClient) Delete(table string, filter string) ([]byte, error) {
+	if !isIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	q, err := parseQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.conditions) == 0 {
+		return nil, errors.New("delete requires a filter")
+	}
+
+	where, args := whereClause(q.conditions)
+	if _, err := c.db.Exec(fmt.Sprintf(`DELETE FROM %s%s`, table, where), args...); err != nil {
+		return nil, err
+	}
+	return []byte{}, nil
+}
+
+func (c *sqliteClient) query(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, missingTable(err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(types))
+		pointers := make([]interface{}, len(types))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := map[string]interface{}{}
+		for i, t := range types {
+			row[t.Name()] = fromSqlValue(values[i], t.DatabaseTypeName())
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func whereClause(conditions []condition) (string, []interface{}) {
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	clauses := []string{}
+	args := []interface{}{}
+	for _, cond := range conditions {
+		clause, condArgs := conditionClause(cond)
+		clauses = append(clauses, clause)
+		args = append(args, condArgs...)
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+func conditionClause(cond condition) (string, []interface{}) {
+	column := `"` + cond.column + `"`
+	switch cond.operator {
+	case "or":
+		clauses := []string{}
+		args := []interface{}{}
+		for _, sub := range cond.or {
+			clause, subArgs := conditionClause(sub)
+			clauses = append(clauses, clause)
+			args = append(args, subArgs...)
+		}
+		return "(" + strings.Join(clauses, " OR ") + ")", args
+	case "is":
+		switch strings.ToLower(cond.value) {
+		case "null":
+			return column + " IS NULL", nil
+		case "true":
+			return column + " = 1", nil
+		default:
+			return column + " = 0", nil
+		}
+	case "in":
+		values := strings.Split(strings.Trim(cond.value, "()"), ",")
+		placeholders := make([]string, len(values))
+		args := make([]interface{}, len(values))
+		for i, v := range values {
+			placeholders[i] = "?"
+			args[i] = filterValue(strings.Trim(v, `"`))
+		}
+		return column + " IN (" + strings.Join(placeholders, ", ") + ")", args
+	case "ilike":
+		pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(cond.value)
+		return column + " LIKE ? ESCAPE '\\'", []interface{}{strings.ReplaceAll(pattern, "*", "%")}
+	default:
+		return column + " " + sqlOperators[cond.operator] + " ?", []interface{}{filterValue(cond.value)}
+	}
+}
+
+// toRecords turns an insert payload (a struct, a map or a slice of them)
+// into column/value maps using the same JSON names PostgREST would see.
+func toRecords(data interface{}) ([]map[string]interface{}, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		records := []map[string]interface{}{}
+		if err := decoder.Decode(&records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+
+	record := map[string]interface{}{}
+	if err := decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{record}, nil
+}
+
+func toSqlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		return normalizeTime(v)
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	default:
+		return v
+	}
+}
+
+func fromSqlValue(value interface{}, declaredType string) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case int64:
+		if strings.EqualFold(declaredType, "BOOLEAN") {
+			return v != 0
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func filterValue(value string) interface{} {
+	switch value {
+	case "true":
+		return 1
+	case "false":
+		return 0
+	}
+	return normalizeTime(value)
+}
+
+func normalizeTime(value string) string {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.UTC().Format(timeLayout)
+	}
+	return value
+}
+
+// conflict marks unique violations with ErrConflict like the Supabase client.
+func conflict(err error) error {
+	if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return fmt.Errorf("%v: %w", err, ErrConflict)
+	}
+	return err
+}
+
+func missingTable(err error) error {
+	if strings.Contains(err.Error(), "no such table") {
+		return fmt.Errorf("%v: %w", err, ErrNoTable)
+	}
+	return err
+}
+
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate uuid: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,303 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sqliteFunctions stand in for the functions the migrations create in
+// Postgres. Each one runs in a transaction of its own.
+var sqliteFunctions = map[string]func(tx *sql.Tx, params map[string]interface{}) (interface{}, error){
+	"take_rate_limit_hit": takeRateLimitHit,
+	"count_clicks":        countClicks,
+	"link_stats":          linkStats,
+	"take_link_quota":     takeLinkQuota,
+}
+
+func (c *sqliteClient) Rpc(function string, params interface{}) ([]byte, error) {
+	call, ok := sqliteFunctions[function]
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s", function)
+	}
+
+	records, err := toRecords(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != 1 {
+		return nil, fmt.Errorf("%s takes a single object of params", function)
+	}
+
+	// with a single connection the transaction runs alone
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := call(tx, records[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+// takeRateLimitHit mirrors 0010_create_take_rate_limit_hit.up.sql.
+func takeRateLimitHit(tx *sql.Tx, params map[string]interface{}) (interface{}, error) {
+	key := fmt.Sprint(params["hit_key"])
+	maxHits, err := params["max_hits"].(json.Number).Int64()
+	if err != nil {
+		return nil, err
+	}
+	window, err := params["window_seconds"].(json.Number).Float64()
+	if err != nil {
+		return nil, err
+	}
+	at, err := time.Parse(time.RFC3339Nano, fmt.Sprint(params["at"]))
+	if err != nil {
+		return nil, err
+	}
+	period := time.Duration(window * float64(time.Second))
+
+	var hits int64
+	var oldest sql.NullString
+	err = tx.QueryRow(`SELECT count(*), min(created_at) FROM rate_limit_hits WHERE "Key" = ? AND created_at > ?`,
+		key, at.Add(-period).UTC().Format(timeLayout)).Scan(&hits, &oldest)
+	if err != nil {
+		return nil, err
+	}
+
+	row := map[string]interface{}{"allowed": hits < maxHits, "hits": hits, "oldest": nil}
+	if oldest.Valid {
+		oldestAt, err := time.Parse(timeLayout, oldest.String)
+		if err != nil {
+			return nil, err
+		}
+		row["oldest"] = oldestAt
+	}
+
+	if hits < maxHits {
+		uuid, err := newUUID()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(`INSERT INTO rate_limit_hits (uuid, "Key", "Expires_at", created_at) VALUES (?, ?, ?, ?)`,
+			uuid, key, at.Add(period).UTC().Format(timeLayout), at.UTC().Format(timeLayout))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []map[string]interface{}{row}, nil
+}
+
+// countClicks mirrors 0011_create_count_clicks.up.sql.
+func countClicks(tx *sql.Tx, params map[string]interface{}) (interface{}, error) {
+	hashes, ok := params["hashes"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("count_clicks: hashes must be an array")
+	}
+
+	rows := []map[string]interface{}{}
+	if len(hashes) == 0 {
+		return rows, nil
+	}
+
+	args := make([]interface{}, len(hashes))
+	for i, hash := range hashes {
+		args[i] = fmt.Sprint(hash)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(hashes)), ", ")
+
+	result, err := tx.Query(`SELECT "Hash", count(*) FROM clicks WHERE "Hash" IN (`+placeholders+`) GROUP BY "Hash"`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	for result.Next() {
+		var hash string
+		var clicks int64
+		if err := result.Scan(&hash, &clicks); err != nil {
+			return nil, err
+		}
+		rows = append(rows, map[string]interface{}{"hash": hash, "clicks": clicks})
+	}
+	return rows, result.Err()
+}
+
+// linkStats mirrors 0013_create_link_stats.up.sql.
+func linkStats(tx *sql.Tx, params map[string]interface{}) (interface{}, error) {
+	hash := fmt.Sprint(params["link_hash"])
+	since, err := time.Parse(time.RFC3339Nano, fmt.Sprint(params["since"]))
+	if err != nil {
+		return nil, err
+	}
+	topN, err := params["top_n"].(json.Number).Int64()
+	if err != nil {
+		return nil, err
+	}
+	from := since.UTC().Format(timeLayout)
+	const window = `FROM clicks WHERE "Hash" = ? AND created_at >= ?`
+
+	var total, unique int64
+	err = tx.QueryRow(`SELECT count(*), count(DISTINCT NULLIF("Ip_hash", '')) `+window, hash, from).Scan(&total, &unique)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := map[string]interface{}{"total_clicks": total, "unique_visitors": unique, "last_click": nil}
+
+	var last sql.NullString
+	if err := tx.QueryRow(`SELECT max(created_at) FROM clicks WHERE "Hash" = ?`, hash).Scan(&last); err != nil {
+		return nil, err
+	}
+	if last.Valid {
+		lastAt, err := time.Parse(timeLayout, last.String)
+		if err != nil {
+			return nil, err
+		}
+		stats["last_click"] = lastAt
+	}
+
+	days, err := groupCounts(tx, `SELECT substr(created_at, 1, 10), count(*) `+window+` GROUP BY 1 ORDER BY 1`, hash, from)
+	if err != nil {
+		return nil, err
+	}
+	perDay := []map[string]interface{}{}
+	for _, day := range days {
+		perDay = append(perDay, map[string]interface{}{"day": day.key, "clicks": day.count})
+	}
+	stats["per_day"] = perDay
+
+	raw, err := groupCounts(tx, `SELECT "Referrer", count(*) `+window+` GROUP BY "Referrer"`, hash, from)
+	if err != nil {
+		return nil, err
+	}
+	hosts := map[string]int64{}
+	for _, referrer := range raw {
+		hosts[referrerHost(referrer.key)] += referrer.count
+	}
+	referrers := []keyCount{}
+	for host, count := range hosts {
+		referrers = append(referrers, keyCount{host, count})
+	}
+	sort.Slice(referrers, func(i, j int) bool {
+		if referrers[i].count != referrers[j].count {
+			return referrers[i].count > referrers[j].count
+		}
+		return referrers[i].key < referrers[j].key
+	})
+	topReferrers := []map[string]interface{}{}
+	for i, referrer := range referrers {
+		if int64(i) == topN {
+			break
+		}
+		topReferrers = append(topReferrers, map[string]interface{}{"referrer": referrer.key, "clicks": referrer.count})
+	}
+	stats["referrers"] = topReferrers
+
+	countries, err := groupCounts(tx, `SELECT "Country", count(*) `+window+` AND "Country" <> '' GROUP BY "Country" ORDER BY 2 DESC, 1 LIMIT ?`, hash, from, topN)
+	if err != nil {
+		return nil, err
+	}
+	topCountries := []map[string]interface{}{}
+	for _, country := range countries {
+		topCountries = append(topCountries, map[string]interface{}{"country": country.key, "clicks": country.count})
+	}
+	stats["countries"] = topCountries
+
+	return stats, nil
+}
+
+type keyCount struct {
+	key   string
+	count int64
+}
+
+func groupCounts(tx *sql.Tx, query string, args ...interface{}) ([]keyCount, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []keyCount{}
+	for rows.Next() {
+		var row keyCount
+		if err := rows.Scan(&row.key, &row.count); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// referrerHost matches the referrer expression of link_stats.
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return "direct"
+	}
+	if u, err := url.Parse(referrer); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return referrer
+}
+
+// takeLinkQuota mirrors 0014_create_take_link_quota.up.sql.
+func takeLinkQuota(tx *sql.Tx, params map[string]interface{}) (interface{}, error) {
+	creator, err := params["creator"].(json.Number).Int64()
+	if err != nil {
+		return nil, err
+	}
+	at, err := time.Parse(time.RFC3339Nano, fmt.Sprint(params["at"]))
+	if err != nil {
+		return nil, err
+	}
+
+	windows := []struct {
+		limit  string
+		period time.Duration
+		name   string
+	}{
+		{"per_minute", time.Minute, "minute"},
+		{"per_day", 24 * time.Hour, "day"},
+	}
+	for _, window := range windows {
+		limit, err := params[window.limit].(json.Number).Int64()
+		if err != nil {
+			return nil, err
+		}
+		if limit <= 0 {
+			continue
+		}
+
+		var created int64
+		err = tx.QueryRow(`SELECT count(*) FROM link_creations WHERE "Telegram_id" = ? AND created_at >= ?`,
+			creator, at.Add(-window.period).UTC().Format(timeLayout)).Scan(&created)
+		if err != nil {
+			return nil, err
+		}
+		if created >= limit {
+			return []map[string]interface{}{{"allowed": false, "exceeded": window.name, "creation": nil}}, nil
+		}
+	}
+
+	uuid, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`INSERT INTO link_creations (uuid, "Telegram_id", "Hash", created_at) VALUES (?, ?, ?, ?)`,
+		uuid, creator, fmt.Sprint(params["link_hash"]), at.UTC().Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{{"allowed": true, "exceeded": nil, "creation": uuid}}, nil
+}
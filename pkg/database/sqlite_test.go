@@ -0,0 +1,252 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shorter-bot/pkg/models"
+)
+
+func newTestSqlite(t *testing.T) SupabaseClient {
+	t.Helper()
+	client, err := NewSqliteClient(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	return client
+}
+
+func TestSqlite_InsertAndGet(t *testing.T) {
+	client := newTestSqlite(t)
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond)
+
+	resp, err := client.Insert("urls", models.Url{Telegram_id: 123456789012, Hash: "42", Url: "https://example.com?a=1&b=2", Expires_at: &expiresAt})
+	if err != nil {
+		t.Fatalf("unexpected insert error: %v", err)
+	}
+
+	var inserted []models.Url
+	if err := json.Unmarshal(resp, &inserted); err != nil || len(inserted) != 1 {
+		t.Fatalf("expected one inserted row, got %s (%v)", resp, err)
+	}
+
+	if _, err := client.Insert("urls", models.Url{Telegram_id: 1, Hash: "42", Url: "https://other.com"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict for a taken hash, got %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		filters   map[string]string
+		expectErr error
+	}{
+		{name: "by hash", filters: map[string]string{"Hash": "42"}},
+		{name: "by hash and telegram id", filters: map[string]string{"Hash": "42", "Telegram_id": "123456789012"}},
+		{name: "no match", filters: map[string]string{"Hash": "43"}, expectErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := client.Get("urls", tt.filters)
+			if tt.expectErr != nil {
+				if !errors.Is(err, tt.expectErr) {
+					t.Fatalf("expected %v, got %v", tt.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got models.Url
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("invalid json %s: %v", body, err)
+			}
+			if got.Url != "https://example.com?a=1&b=2" || got.Telegram_id != 123456789012 {
+				t.Errorf("unexpected row: %+v", got)
+			}
+			if got.Expires_at == nil || !got.Expires_at.Equal(expiresAt) {
+				t.Errorf("expected expires_at %v, got %v", expiresAt, got.Expires_at)
+			}
+		})
+	}
+}
+
+func TestSqlite_GetMultipleRows(t *testing.T) {
+	client := newTestSqlite(t)
+	for _, hash := range []string{"1", "2"} {
+		if _, err := client.Insert("urls", models.Url{Telegram_id: 7, Hash: hash, Url: "https://example.com"}); err != nil {
+			t.Fatalf("unexpected insert error: %v", err)
+		}
+	}
+
+	_, err := client.Get("urls", map[string]string{"Telegram_id": "7"})
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected multiple rows error, got %v", err)
+	}
+}
+
+func TestSqlite_Delete(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		filter    string
+		remaining []string
+		expectErr bool
+	}{
+		{name: "by hash", filter: "Hash=eq.1", remaining: []string{"2", "3"}},
+		{name: "expired", filter: "Expires_at=lt." + time.Now().UTC().Format(time.RFC3339), remaining: []string{"2", "3"}},
+		{name: "in list", filter: "Hash=in.(1,3)", remaining: []string{"2"}},
+		{name: "empty filter", filter: "", remaining: []string{"1", "2", "3"}, expectErr: true},
+		{name: "unknown operator", filter: "Hash=like.1", remaining: []string{"1", "2", "3"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestSqlite(t)
+			client.Insert("urls", models.Url{Telegram_id: 1, Hash: "1", Url: "https://a.com", Expires_at: &past})
+			client.Insert("urls", models.Url{Telegram_id: 1, Hash: "2", Url: "https://b.com", Expires_at: &future})
+			client.Insert("urls", models.Url{Telegram_id: 1, Hash: "3", Url: "https://c.com"})
+
+			_, err := client.Delete("urls", tt.filter)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error = %v, got %v", tt.expectErr, err)
+			}
+
+			for _, hash := range []string{"1", "2", "3"} {
+				_, err := client.Get("urls", map[string]string{"Hash": hash})
+				want := false
+				for _, r := range tt.remaining {
+					want = want || r == hash
+				}
+				if (err == nil) != want {
+					t.Errorf("hash %s: expected present = %v, got error %v", hash, want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSqlite_Select(t *testing.T) {
+	client := newTestSqlite(t)
+	base := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	clicks := []models.Click{}
+	for i := 0; i < 5; i++ {
+		clicks = append(clicks, models.Click{Hash: "abc", Ip_hash: "ip", Created_at: base.Add(time.Duration(i) * time.Hour)})
+	}
+	clicks = append(clicks, models.Click{Hash: "other", Created_at: base})
+
+	if _, err := client.Insert("clicks", clicks); err != nil {
+		t.Fatalf("unexpected bulk insert error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		wantHours []int
+		expectErr bool
+	}{
+		{name: "filter and order", query: "Hash=eq.abc&order=created_at.desc", wantHours: []int{4, 3, 2, 1, 0}},
+		{name: "time range", query: "Hash=eq.abc&created_at=gte.2025-03-01T03:00:00Z&order=created_at.asc", wantHours: []int{3, 4}},
+		{name: "limit and offset", query: "Hash=eq.abc&order=created_at.asc&limit=2&offset=1", wantHours: []int{1, 2}},
+		{name: "select columns", query: "select=Hash,created_at&Hash=eq.abc&limit=1", wantHours: []int{0}},
+		{name: "case-insensitive pattern", query: "Hash=ilike.AB*&order=created_at.asc&limit=1", wantHours: []int{0}},
+		{name: "any of", query: "Hash=eq.abc&or=(created_at.lt.2025-03-01T01:00:00Z,created_at.gt.2025-03-01T03:00:00Z)&order=created_at.asc", wantHours: []int{0, 4}},
+		{name: "invalid order", query: "order=created_at.sideways", expectErr: true},
+		{name: "invalid or", query: "or=created_at.is.null", expectErr: true},
+	}
+
+	count, err := client.Count("clicks", "Hash=eq.abc&created_at=gte.2025-03-01T03:00:00Z")
+	if err != nil || count != 2 {
+		t.Errorf("expected count 2, got %d (%v)", count, err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := client.Select("clicks", tt.query)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error = %v, got %v", tt.expectErr, err)
+			}
+			if tt.expectErr {
+				return
+			}
+
+			var got []models.Click
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("invalid json %s: %v", body, err)
+			}
+			if len(got) != len(tt.wantHours) {
+				t.Fatalf("expected %d rows, got %d", len(tt.wantHours), len(got))
+			}
+			for i, hour := range tt.wantHours {
+				if got[i].Created_at.Hour() != hour {
+					t.Errorf("row %d: expected hour %d, got %v", i, hour, got[i].Created_at)
+				}
+			}
+		})
+	}
+}
+
+func TestSqlite_Update(t *testing.T) {
+	client := newTestSqlite(t)
+	client.Insert("urls", models.Url{Telegram_id: 1, Hash: "1", Url: "https://a.com"})
+	client.Insert("urls", models.Url{Telegram_id: 1, Hash: "2", Url: "https://b.com"})
+
+	resp, err := client.Update("urls", "Hash=eq.1", map[string]interface{}{"Disabled": true})
+	if err != nil {
+		t.Fatalf("unexpected update error: %v", err)
+	}
+
+	var updated []models.Url
+	if err := json.Unmarshal(resp, &updated); err != nil || len(updated) != 1 || !updated[0].Disabled {
+		t.Fatalf("expected one disabled row, got %s (%v)", resp, err)
+	}
+
+	body, _ := client.Get("urls", map[string]string{"Hash": "2"})
+	var untouched models.Url
+	json.Unmarshal(body, &untouched)
+	if untouched.Disabled {
+		t.Errorf("expected hash 2 to stay enabled")
+	}
+
+	if _, err := client.Update("urls", "", map[string]interface{}{"Disabled": true}); err == nil {
+		t.Errorf("expected an error for an update without filter")
+	}
+}
+
+func TestSqlite_RpcCountClicks(t *testing.T) {
+	client := newTestSqlite(t)
+	for _, hash := range []string{"abc", "abc", "xyz"} {
+		if _, err := client.Insert("clicks", models.Click{Hash: hash}); err != nil {
+			t.Fatalf("failed to insert click: %v", err)
+		}
+	}
+
+	body, err := client.Rpc("count_clicks", map[string]interface{}{"hashes": []string{"abc", "xyz", "none"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var rows []struct {
+		Hash   string `json:"hash"`
+		Clicks int    `json:"clicks"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		t.Fatalf("invalid body %s: %v", body, err)
+	}
+	counts := map[string]int{}
+	for _, row := range rows {
+		counts[row.Hash] = row.Clicks
+	}
+	if len(counts) != 2 || counts["abc"] != 2 || counts["xyz"] != 1 {
+		t.Errorf("unexpected counts %s", body)
+	}
+
+	if _, err := client.Rpc("count_clicks", map[string]interface{}{"hashes": []string{}}); err != nil {
+		t.Errorf("unexpected error for no hashes: %v", err)
+	}
+}
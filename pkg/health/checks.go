@@ -0,0 +1,102 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"url-shorter-bot/pkg/migration"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Check is one readiness condition of the service.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type Selecter interface {
+	Select(table string, query string) ([]byte, error)
+}
+
+type MigrationStatuser interface {
+	Status() ([]migration.Status, error)
+}
+
+type TelegramRequester interface {
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
+}
+
+// Database reads a single row to check the database answers.
+func Database(db Selecter) Check {
+	return Check{Name: "database", Check: func(ctx context.Context) error {
+		_, err := db.Select("urls", "limit=1")
+		return err
+	}}
+}
+
+// Migrations checks that every migration is applied and unchanged since.
+func Migrations(runner MigrationStatuser) Check {
+	return Check{Name: "migrations", Check: func(ctx context.Context) error {
+		statuses, err := runner.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.State != migration.StateApplied {
+				return fmt.Errorf("migration %04d_%s is %s", s.Version, s.Name, s.State)
+			}
+		}
+		return nil
+	}}
+}
+
+// Tables checks that every table of the schema exists, for databases
+// without versioned migrations.
+func Tables(db Selecter, tables []string) Check {
+	return Check{Name: "migrations", Check: func(ctx context.Context) error {
+		for _, table := range tables {
+			if _, err := db.Select(table, "limit=1"); err != nil {
+				return errors.New("table " + table + ": " + err.Error())
+			}
+		}
+		return nil
+	}}
+}
+
+// Telegram calls getMe with the bot token.
+func Telegram(bot TelegramRequester) Check {
+	return Check{Name: "telegram", Check: func(ctx context.Context) error {
+		resp, err := bot.MakeRequest("getMe", nil)
+		if err != nil {
+			return err
+		}
+		if !resp.Ok {
+			return errors.New(resp.Description)
+		}
+		return nil
+	}}
+}
+
+// Cached remembers a successful result of c for ttl, so frequent probes do
+// not hit remote services every time. Failures are always retried.
+func Cached(c Check, ttl time.Duration) Check {
+	var mu sync.Mutex
+	var passedAt time.Time
+
+	return Check{Name: c.Name, Check: func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if time.Since(passedAt) < ttl {
+			return nil
+		}
+		if err := c.Check(ctx); err != nil {
+			return err
+		}
+		passedAt = time.Now()
+		return nil
+	}}
+}
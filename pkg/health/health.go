@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+	"url-shorter-bot/pkg/buildinfo"
+)
+
+// CheckTimeout bounds every readiness check.
+const CheckTimeout = 3 * time.Second
+
+type Handler struct {
+	checks []Check
+	config interface{}
+}
+
+// NewHandler serves the probes. config is shown by /version and must not
+// contain secrets.
+func NewHandler(config interface{}, checks ...Check) *Handler {
+	return &Handler{checks: checks, config: config}
+}
+
+// HandlerHealthz answers as long as the process serves HTTP.
+func (h *Handler) HandlerHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandlerReadyz runs every check and answers 503 unless all of them pass.
+func (h *Handler) HandlerReadyz(w http.ResponseWriter, r *http.Request) {
+	results := make(map[string]string, len(h.checks))
+	status, code := "ready", http.StatusOK
+
+	for _, check := range h.checks {
+		if err := run(r.Context(), check); err != nil {
+			results[check.Name] = err.Error()
+			status, code = "not ready", http.StatusServiceUnavailable
+			continue
+		}
+		results[check.Name] = "ok"
+	}
+
+	writeJSON(w, code, map[string]interface{}{"status": status, "checks": results})
+}
+
+// HandlerVersion shows the build and the non-secret configuration.
+func (h *Handler) HandlerVersion(w http.ResponseWriter, r *http.Request) {
+	info := buildinfo.Get()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"commit":     info.Commit,
+		"build_time": info.BuildTime,
+		"go_version": info.GoVersion,
+		"config":     h.config,
+	})
+}
+
+// run gives up on a check after CheckTimeout, the database and Telegram
+// clients take no context.
+func run(ctx context.Context, check Check) error {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- check.Check(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,209 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"url-shorter-bot/pkg/migration"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type mockSelecter struct {
+	missing string
+	calls   int
+}
+
+func (m *mockSelecter) Select(table string, query string) ([]byte, error) {
+	m.calls++
+	if table == m.missing {
+		return nil, errors.New("relation does not exist")
+	}
+	return []byte(`[]`), nil
+}
+
+type mockStatuser struct {
+	statuses []migration.Status
+	err      error
+}
+
+func (m *mockStatuser) Status() ([]migration.Status, error) {
+	return m.statuses, m.err
+}
+
+type mockTelegram struct {
+	ok bool
+}
+
+func (m *mockTelegram) MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	return &tgbotapi.APIResponse{Ok: m.ok, Description: "Unauthorized"}, nil
+}
+
+func TestHandlerReadyz(t *testing.T) {
+	tests := []struct {
+		name           string
+		db             *mockSelecter
+		bot            *mockTelegram
+		expectedStatus int
+		expectedChecks map[string]string
+	}{
+		{
+			name:           "ready",
+			db:             &mockSelecter{},
+			bot:            &mockTelegram{ok: true},
+			expectedStatus: http.StatusOK,
+			expectedChecks: map[string]string{"database": "ok", "migrations": "ok", "telegram": "ok"},
+		},
+		{
+			name:           "missing table",
+			db:             &mockSelecter{missing: "clicks"},
+			bot:            &mockTelegram{ok: true},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"database": "ok", "migrations": "table clicks: relation does not exist", "telegram": "ok"},
+		},
+		{
+			name:           "database down",
+			db:             &mockSelecter{missing: "urls"},
+			bot:            &mockTelegram{ok: true},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"database": "relation does not exist", "migrations": "table urls: relation does not exist", "telegram": "ok"},
+		},
+		{
+			name:           "invalid bot token",
+			db:             &mockSelecter{},
+			bot:            &mockTelegram{},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"database": "ok", "migrations": "ok", "telegram": "Unauthorized"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(nil, Database(tt.db), Tables(tt.db, []string{"urls", "clicks"}), Telegram(tt.bot))
+
+			w := httptest.NewRecorder()
+			h.HandlerReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var body struct {
+				Checks map[string]string `json:"checks"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("invalid body: %v", err)
+			}
+			for name, expected := range tt.expectedChecks {
+				if body.Checks[name] != expected {
+					t.Errorf("check %s: expected %q, got %q", name, expected, body.Checks[name])
+				}
+			}
+		})
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		runner   *mockStatuser
+		expected string
+	}{
+		{
+			name: "all applied",
+			runner: &mockStatuser{statuses: []migration.Status{
+				{Version: 1, Name: "create_users_info", State: migration.StateApplied},
+				{Version: 2, Name: "create_urls", State: migration.StateApplied},
+			}},
+		},
+		{
+			name: "pending",
+			runner: &mockStatuser{statuses: []migration.Status{
+				{Version: 1, Name: "create_users_info", State: migration.StateApplied},
+				{Version: 2, Name: "create_urls", State: migration.StatePending},
+			}},
+			expected: "migration 0002_create_urls is pending",
+		},
+		{
+			name: "modified",
+			runner: &mockStatuser{statuses: []migration.Status{
+				{Version: 1, Name: "create_users_info", State: migration.StateModified},
+			}},
+			expected: "migration 0001_create_users_info is modified",
+		},
+		{
+			name:     "status failed",
+			runner:   &mockStatuser{err: errors.New("connection refused")},
+			expected: "connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Migrations(tt.runner).Check(context.Background())
+			if tt.expected == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.expected != "" && (err == nil || err.Error() != tt.expected) {
+				t.Errorf("expected error %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestHandlerReadyz_Timeout(t *testing.T) {
+	stuck := Check{Name: "stuck", Check: func(ctx context.Context) error {
+		time.Sleep(time.Minute)
+		return nil
+	}}
+	h := NewHandler(nil, stuck)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	h.HandlerReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil).WithContext(ctx))
+
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "deadline exceeded") {
+		t.Errorf("expected a timed out check, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCached(t *testing.T) {
+	db := &mockSelecter{}
+	check := Cached(Database(db), time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if err := check.Check(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if db.calls != 1 {
+		t.Errorf("expected a passed check to be cached, got %d calls", db.calls)
+	}
+
+	db.missing = "urls"
+	failing := Cached(Database(db), time.Hour)
+	failing.Check(context.Background())
+	failing.Check(context.Background())
+	if db.calls != 3 {
+		t.Errorf("expected a failed check to be retried, got %d calls", db.calls)
+	}
+}
+
+func TestHandlerVersion(t *testing.T) {
+	h := NewHandler(map[string]string{"db_driver": "sqlite"})
+
+	w := httptest.NewRecorder()
+	h.HandlerVersion(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	for _, expected := range []string{`"commit"`, `"build_time"`, `"go_version"`, `"db_driver":"sqlite"`} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected body to contain %s, got %s", expected, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Manager runs the long-lived workers of the service. On shutdown they are
+// stopped one by one in reverse order of Go, so a worker registered first
+// (e.g. the log writer) still runs while the later ones drain into it.
+type Manager struct {
+	mu      sync.Mutex
+	workers []*worker
+	exited  chan string
+	errs    []error
+}
+
+type worker struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewManager() *Manager {
+	return &Manager{exited: make(chan string, 1)}
+}
+
+// Go starts run in its own goroutine. Its context is cancelled when the
+// worker has to stop; a worker returning on its own starts the shutdown.
+func (m *Manager) Go(name string, run func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &worker{name: name, cancel: cancel, done: make(chan struct{})}
+
+	m.mu.Lock()
+	m.workers = append(m.workers, w)
+	m.mu.Unlock()
+
+	go func() {
+		defer close(w.done)
+
+		err := run(ctx)
+		if err != nil {
+			m.mu.Lock()
+			m.errs = append(m.errs, fmt.Errorf("%s: %w", name, err))
+			m.mu.Unlock()
+		}
+		if ctx.Err() == nil {
+			select {
+			case m.exited <- name:
+			default:
+			}
+		}
+	}()
+}
+
+// Wait blocks until ctx is done or a worker exits, then stops every worker
+// within timeout. It returns the errors of the workers.
+func (m *Manager) Wait(ctx context.Context, timeout time.Duration) error {
+	select {
+	case <-ctx.Done():
+		log.Println("Shutting down...")
+	case name := <-m.exited:
+		log.Printf("%s stopped, shutting down...", name)
+	}
+
+	deadline := time.After(timeout)
+
+	m.mu.Lock()
+	workers := m.workers
+	m.mu.Unlock()
+
+	timedOut := false
+	for i := len(workers) - 1; i >= 0; i-- {
+		w := workers[i]
+		w.cancel()
+		if timedOut {
+			continue
+		}
+
+		select {
+		case <-w.done:
+		case <-deadline:
+			timedOut = true
+			m.mu.Lock()
+			m.errs = append(m.errs, fmt.Errorf("%s: not stopped after %v", w.name, timeout))
+			m.mu.Unlock()
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return errors.Join(m.errs...)
+}
+
+// Server returns a worker that serves with listen, e.g. server.ListenAndServe,
+// and shuts server down gracefully within timeout once it has to stop.
+func Server(server *http.Server, listen func() error, timeout time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		failed := make(chan error, 1)
+		go func() {
+			if err := listen(); !errors.Is(err, http.ErrServerClosed) {
+				failed <- err
+			}
+		}()
+
+		select {
+		case err := <-failed:
+			return err
+		case <-ctx.Done():
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
@@ -0,0 +1,112 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManager_StopsInReverseOrder(t *testing.T) {
+	var mu sync.Mutex
+	var stopped []string
+
+	m := NewManager()
+	for _, name := range []string{"logger", "bot", "server"} {
+		name := name
+		m.Go(name, func(ctx context.Context) error {
+			<-ctx.Done()
+			mu.Lock()
+			stopped = append(stopped, name)
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Wait(ctx, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := strings.Join(stopped, ","); got != "server,bot,logger" {
+		t.Errorf("expected workers to stop in reverse order, got %s", got)
+	}
+}
+
+func TestManager_FailedWorker(t *testing.T) {
+	m := NewManager()
+	stopped := make(chan struct{})
+	m.Go("logger", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	})
+	m.Go("server", func(ctx context.Context) error {
+		return errors.New("address already in use")
+	})
+
+	err := m.Wait(context.Background(), time.Second)
+	if err == nil || !strings.Contains(err.Error(), "server: address already in use") {
+		t.Fatalf("expected the error of the server, got %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("expected the other workers to be stopped")
+	}
+}
+
+func TestManager_Timeout(t *testing.T) {
+	m := NewManager()
+	m.Go("stuck", func(ctx context.Context) error {
+		select {}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := m.Wait(ctx, 20*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "stuck: not stopped") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	inFlight := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inFlight)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("done"))
+	})}
+
+	m := NewManager()
+	m.Go("server", Server(server, func() error { return server.Serve(listener) }, time.Second))
+
+	response := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		response <- err
+	}()
+	<-inFlight
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Wait(ctx, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := <-response; err != nil {
+		t.Errorf("expected the request in flight to finish, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"context"
+	"log"
+)
+
+type entry struct {
+	isError    bool
+	telegramID int64
+	action     string
+	errMsg     string
+	code       string
+}
+
+// AsyncLogger queues log entries and writes them through next in the
+// background, so callers never wait for the database. Entries still queued
+// on shutdown are written before Run returns.
+type AsyncLogger struct {
+	next    Logger
+	entries chan entry
+}
+
+func NewAsyncLogger(next Logger, size int) *AsyncLogger {
+	return &AsyncLogger{next: next, entries: make(chan entry, size)}
+}
+
+func (l *AsyncLogger) LogAction(telegramID int64, action string) {
+	l.queue(entry{telegramID: telegramID, action: action})
+}
+
+func (l *AsyncLogger) LogError(telegramID int64, errMsg, code string) {
+	l.queue(entry{isError: true, telegramID: telegramID, errMsg: errMsg, code: code})
+}
+
+// queue drops the entry when the queue is full rather than blocking the
+// caller.
+func (l *AsyncLogger) queue(e entry) {
+	select {
+	case l.entries <- e:
+	default:
+		log.Printf("log queue is full, dropping entry of %d", e.telegramID)
+	}
+}
+
+func (l *AsyncLogger) Run(ctx context.Context) error {
+	for {
+		select {
+		case e := <-l.entries:
+			l.write(e)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-l.entries:
+					l.write(e)
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func (l *AsyncLogger) write(e entry) {
+	if e.isError {
+		l.next.LogError(e.telegramID, e.errMsg, e.code)
+		return
+	}
+	l.next.LogAction(e.telegramID, e.action)
+}
@@ -2,7 +2,9 @@ package logger
 
 import (
 	"log"
+	"url-shorter-bot/pkg/metrics"
 	"url-shorter-bot/pkg/models"
+	"url-shorter-bot/pkg/users"
 )
 
 type SupabaseInserter interface {
@@ -10,30 +12,57 @@ type SupabaseInserter interface {
 }
 
 type SupabaseLogger struct {
-	db SupabaseInserter
+	db    SupabaseInserter
+	users users.IdentityResolver
 }
 
-func NewDatabaseLogger(db SupabaseInserter) *SupabaseLogger {
-	return &SupabaseLogger{db: db}
+func NewDatabaseLogger(db SupabaseInserter, users users.IdentityResolver) *SupabaseLogger {
+	return &SupabaseLogger{db: db, users: users}
 }
 
 func (l *SupabaseLogger) LogAction(telegramID int64, action string) {
+	userUuid, ok := l.resolve("log_action", telegramID)
+	if !ok {
+		return
+	}
+
 	payload := models.LogAction{
+		User_uuid:   userUuid,
 		Telegram_id: telegramID,
 		Action:      action,
 	}
 	if _, err := l.db.Insert("log_action", payload); err != nil {
+		metrics.LogFailures.Inc("log_action")
 		log.Printf("log action failed: %v", err)
 	}
 }
 
 func (l *SupabaseLogger) LogError(telegramID int64, errMsg, code string) {
+	userUuid, ok := l.resolve("log_error", telegramID)
+	if !ok {
+		return
+	}
+
 	payload := models.LogError{
+		User_uuid:   userUuid,
 		Telegram_id: telegramID,
 		Error:       errMsg,
 		Error_code:  code,
 	}
 	if _, err := l.db.Insert("log_error", payload); err != nil {
+		metrics.LogFailures.Inc("log_error")
 		log.Printf("log error failed: %v", err)
 	}
 }
+
+// resolve finds the user row the entry references; without it the insert
+// would fail on the foreign key.
+func (l *SupabaseLogger) resolve(table string, telegramID int64) (string, bool) {
+	userUuid, err := l.users.Resolve(telegramID)
+	if err != nil {
+		metrics.LogFailures.Inc(table)
+		log.Printf("%s: resolve user %d failed: %v", table, telegramID, err)
+		return "", false
+	}
+	return userUuid, true
+}
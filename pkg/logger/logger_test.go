@@ -1,7 +1,10 @@
 package logger
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"url-shorter-bot/pkg/models"
 )
@@ -18,6 +21,21 @@ func (m *mockInserter) Insert(table string, data interface{}) ([]byte, error) {
 	return nil, m.returnErr
 }
 
+type stubUsers struct {
+	err error
+}
+
+func (u *stubUsers) Resolve(telegramID int64) (string, error) {
+	if u.err != nil {
+		return "", u.err
+	}
+	return fmt.Sprintf("uuid-%d", telegramID), nil
+}
+
+func (u *stubUsers) Register(telegramID int64, nickName string) (string, error) {
+	return u.Resolve(telegramID)
+}
+
 func TestLogAction(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -45,7 +63,7 @@ func TestLogAction(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &mockInserter{returnErr: tt.returnErr}
-			log := NewDatabaseLogger(mock)
+			log := NewDatabaseLogger(mock, &stubUsers{})
 
 			log.LogAction(tt.telegramID, tt.action)
 
@@ -57,7 +75,7 @@ func TestLogAction(t *testing.T) {
 			if !ok {
 				t.Errorf("unexpected payload type: %T", mock.calledData)
 			}
-			if gotData.Telegram_id != tt.telegramID || gotData.Action != tt.action {
+			if gotData.Telegram_id != tt.telegramID || gotData.Action != tt.action || gotData.User_uuid != fmt.Sprintf("uuid-%d", tt.telegramID) {
 				t.Errorf("unexpected payload data: %+v", gotData)
 			}
 		})
@@ -94,7 +112,7 @@ func TestLogError(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &mockInserter{returnErr: tt.returnErr}
-			log := NewDatabaseLogger(mock)
+			log := NewDatabaseLogger(mock, &stubUsers{})
 
 			log.LogError(tt.telegramID, tt.errMsg, tt.errCode)
 
@@ -106,9 +124,52 @@ func TestLogError(t *testing.T) {
 			if !ok {
 				t.Errorf("unexpected payload type: %T", mock.calledData)
 			}
-			if gotData.Telegram_id != tt.telegramID || gotData.Error != tt.errMsg || gotData.Error_code != tt.errCode {
+			if gotData.Telegram_id != tt.telegramID || gotData.Error != tt.errMsg || gotData.Error_code != tt.errCode || gotData.User_uuid != fmt.Sprintf("uuid-%d", tt.telegramID) {
 				t.Errorf("unexpected payload data: %+v", gotData)
 			}
 		})
 	}
 }
+
+func TestLogAction_UnresolvedUser(t *testing.T) {
+	mock := &mockInserter{}
+	log := NewDatabaseLogger(mock, &stubUsers{err: errors.New("db error")})
+
+	log.LogAction(1, "shortened link")
+
+	if mock.calledTable != "" {
+		t.Errorf("expected no insert without a user row, got one into %s", mock.calledTable)
+	}
+}
+
+type recordingLogger struct {
+	entries []string
+}
+
+func (l *recordingLogger) LogAction(telegramID int64, action string) {
+	l.entries = append(l.entries, action)
+}
+
+func (l *recordingLogger) LogError(telegramID int64, errMsg, code string) {
+	l.entries = append(l.entries, code+" "+errMsg)
+}
+
+func TestAsyncLogger(t *testing.T) {
+	next := &recordingLogger{}
+	log := NewAsyncLogger(next, 2)
+
+	log.LogAction(1, "shortened link")
+	log.LogError(1, "timeout", "504")
+	log.LogAction(1, "dropped")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := log.Run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{"shortened link", "504 timeout"}
+	if strings.Join(next.entries, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %v to be written on shutdown, got %v", want, next.entries)
+	}
+}
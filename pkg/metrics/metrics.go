@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+)
+
+// Default is the registry served on /metrics.
+var Default = NewRegistry()
+
+var (
+	Redirects = Default.NewCounterVec("url_shorter_redirects_total",
+		"Requests of short links by HTTP status.", "status")
+	RedirectDuration = Default.NewHistogramVec("url_shorter_redirect_duration_seconds",
+		"Time to answer requests of short links.", DefaultBuckets)
+	CacheRequests = Default.NewCounterVec("url_shorter_cache_requests_total",
+		"Lookups of short links in the cache by result, hit or miss.", "result")
+
+	DatabaseDuration = Default.NewHistogramVec("url_shorter_database_request_duration_seconds",
+		"Latency of database requests by table and method.", DefaultBuckets, "table", "method")
+	DatabaseErrors = Default.NewCounterVec("url_shorter_database_errors_total",
+		"Failed database requests by table and method.", "table", "method")
+
+	RateLimited = Default.NewCounterVec("url_shorter_rate_limited_total",
+		"Requests rejected by the rate limiter by policy.", "policy")
+
+	BotUpdates = Default.NewCounterVec("url_shorter_bot_updates_total",
+		"Telegram updates by command.", "command")
+
+	LogFailures = Default.NewCounterVec("url_shorter_log_insert_failures_total",
+		"Log entries that could not be written by table.", "table")
+)
+
+// Handler serves the Default registry in the Prometheus text format. With
+// a token, scrapers must send it as a bearer token.
+func Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.Write(w)
+	})
+}
+
+// StatusWriter remembers the status code written to a ResponseWriter.
+type StatusWriter struct {
+	http.ResponseWriter
+	Status int
+}
+
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (w *StatusWriter) WriteHeader(status int) {
+	w.Status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// StatusLabel is the status as a label value.
+func (w *StatusWriter) StatusLabel() string {
+	return strconv.Itoa(w.Status)
+}
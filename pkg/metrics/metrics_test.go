@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	counter := r.NewCounterVec("test_requests_total", "Requests.", "status")
+	histogram := r.NewHistogramVec("test_duration_seconds", "Duration.", []float64{0.1, 1})
+	r.NewGaugeFunc("test_queue_length", "Queue.", func() float64 { return 3 })
+
+	counter.Inc("404")
+	counter.Add(2, "302")
+	counter.Inc(`a"b\c`)
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	var b strings.Builder
+	r.Write(&b)
+
+	want := []string{
+		"# HELP test_requests_total Requests.\n# TYPE test_requests_total counter\n",
+		`test_requests_total{status="302"} 2` + "\n" + `test_requests_total{status="404"} 1` + "\n",
+		`test_requests_total{status="a\"b\\c"} 1` + "\n",
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{le="0.1"} 1` + "\n",
+		`test_duration_seconds_bucket{le="1"} 2` + "\n",
+		`test_duration_seconds_bucket{le="+Inf"} 3` + "\n",
+		"test_duration_seconds_sum 5.55\ntest_duration_seconds_count 3\n",
+		"# TYPE test_queue_length gauge\ntest_queue_length 3\n",
+	}
+	for _, w := range want {
+		if !strings.Contains(b.String(), w) {
+			t.Errorf("expected output to contain %q, got:\n%s", w, b.String())
+		}
+	}
+
+	if counter.Value("302") != 2 || counter.Value("500") != 0 {
+		t.Errorf("unexpected counter values %v, %v", counter.Value("302"), counter.Value("500"))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		token          string
+		header         string
+		expectedStatus int
+	}{
+		{name: "open", expectedStatus: http.StatusOK},
+		{name: "valid token", token: "secret", header: "Bearer secret", expectedStatus: http.StatusOK},
+		{name: "missing token", token: "secret", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", header: "Bearer nope", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			Handler(tt.token).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code == http.StatusOK && !strings.Contains(rr.Body.String(), "# TYPE url_shorter_redirects_total counter") {
+				t.Errorf("expected the default registry, got:\n%s", rr.Body.String())
+			}
+		})
+	}
+}
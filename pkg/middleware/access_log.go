@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"time"
+	"url-shorter-bot/pkg/metrics"
+)
+
+// AccessLogMiddleware writes one line per request to out: the client address,
+// method, path, status and duration.
+func AccessLogMiddleware(out *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			status := metrics.NewStatusWriter(w)
+
+			next.ServeHTTP(status, r)
+
+			out.Printf("%s %s %s %d %s", ClientIP(r), r.Method, r.URL.Path, status.Status, time.Since(start).Round(time.Millisecond))
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+)
+
+// ApiKeyKey holds a digest of the API key a request was authenticated with.
+const ApiKeyKey = contextKey("api_key")
+
+// ApiKeyMiddleware authenticates the key AuthSchemeMiddleware passes on and
+// puts its owner into TelegramIDKey and its digest into ApiKeyKey.
+// Internal callers holding serviceKey may act for any user through the
+// X-Telegram-ID header.
+func ApiKeyMiddleware(keys KeyResolver, serviceKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		trusted := TelegramIDMiddleware(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := credentials(r)
+			if token == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, r, http.StatusUnauthorized, "unauthorized", "Missing API key")
+				return
+			}
+
+			if serviceKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(serviceKey)) == 1 {
+				trusted.ServeHTTP(w, r)
+				return
+			}
+
+			telegramID, err := keys.Resolve(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+				return
+			}
+
+			// only a digest of the key is kept, e.g. by the rate limiter
+			sum := sha256.Sum256([]byte(token))
+			ctx := context.WithValue(r.Context(), TelegramIDKey, telegramID)
+			ctx = context.WithValue(ctx, ApiKeyKey, hex.EncodeToString(sum[:16]))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockResolver struct {
+	keys map[string]int64
+}
+
+func (m *mockResolver) Resolve(key string) (int64, error) {
+	id, ok := m.keys[key]
+	if !ok {
+		return 0, errors.New("invalid API key")
+	}
+	return id, nil
+}
+
+func TestApiKeyMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		authorization  string
+		telegramID     string
+		expectedStatus int
+		expectedID     int64
+	}{
+		{name: "valid key", authorization: "Bearer usb_valid", expectedStatus: http.StatusOK, expectedID: 42},
+		{name: "valid key ignores X-Telegram-ID", authorization: "Bearer usb_valid", telegramID: "7", expectedStatus: http.StatusOK, expectedID: 42},
+		{name: "lowercase scheme", authorization: "bearer usb_valid", expectedStatus: http.StatusOK, expectedID: 42},
+		{name: "unknown key", authorization: "Bearer usb_unknown", expectedStatus: http.StatusUnauthorized},
+		{name: "empty key", authorization: "Bearer ", expectedStatus: http.StatusUnauthorized},
+		{name: "missing header", expectedStatus: http.StatusUnauthorized},
+		{name: "X-Telegram-ID alone", telegramID: "7", expectedStatus: http.StatusUnauthorized},
+		{name: "service key acts for user", authorization: "Bearer service-secret", telegramID: "7", expectedStatus: http.StatusOK, expectedID: 7},
+		{name: "service key without user", authorization: "Bearer service-secret", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotID int64
+			var gotKey string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotID = r.Context().Value(TelegramIDKey).(int64)
+				gotKey, _ = r.Context().Value(ApiKeyKey).(string)
+			})
+			handler := AuthSchemeMiddleware(map[string]func(http.Handler) http.Handler{
+				"Bearer": ApiKeyMiddleware(&mockResolver{keys: map[string]int64{"usb_valid": 42}}, "service-secret"),
+			})(next)
+
+			req := httptest.NewRequest(http.MethodPost, "/short", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.telegramID != "" {
+				req.Header.Set("X-Telegram-ID", tt.telegramID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if gotID != tt.expectedID {
+				t.Errorf("expected telegram id %d, got %d", tt.expectedID, gotID)
+			}
+			// only keys of users count as API keys for the rate limits
+			if (gotKey != "") != (tt.expectedID == 42) {
+				t.Errorf("unexpected API key digest %q", gotKey)
+			}
+		})
+	}
+}
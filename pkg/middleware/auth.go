@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// credentialsKey holds the Authorization header without its scheme.
+const credentialsKey = contextKey("credentials")
+
+// AuthSchemeMiddleware hands a request to the middleware registered for the
+// scheme of its Authorization header, e.g. "Bearer" or "tma". Schemes match
+// case-insensitively and the middleware only gets the credentials, see
+// credentials.
+func AuthSchemeMiddleware(schemes map[string]func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		handlers := map[string]http.Handler{}
+		for scheme, middleware := range schemes {
+			handlers[strings.ToLower(scheme)] = middleware(next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, creds, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+
+			handler, ok := handlers[strings.ToLower(scheme)]
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, r, http.StatusUnauthorized, "unauthorized", "Missing credentials")
+				return
+			}
+			ctx := context.WithValue(r.Context(), credentialsKey, strings.TrimSpace(creds))
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// credentials returns what follows the scheme in the Authorization header of
+// a request passed on by AuthSchemeMiddleware.
+func credentials(r *http.Request) string {
+	creds, _ := r.Context().Value(credentialsKey).(string)
+	return creds
+}
@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const ClientIPKey = contextKey("client_ip")
+
+// ClientCountryKey holds the country code a trusted proxy sent for the client.
+const ClientCountryKey = contextKey("client_country")
+
+// IPResolver finds the address of the client behind the trusted proxies.
+type IPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewIPResolver trusts forwarding headers only from peers in trusted.
+func NewIPResolver(trusted []*net.IPNet) *IPResolver {
+	return &IPResolver{trusted: trusted}
+}
+
+// Resolve returns the client address of r. Behind a trusted peer the
+// Forwarded or X-Forwarded-For chain is walked from the right and the first
+// untrusted hop is the client; X-Real-IP is used when neither is sent.
+// Headers from other peers are ignored, so clients cannot spoof them.
+func (res *IPResolver) Resolve(r *http.Request) net.IP {
+	peer := parseAddr(r.RemoteAddr)
+	if peer == nil || !contains(res.trusted, peer) {
+		return peer
+	}
+
+	chain := forwardedFor(r.Header)
+	if len(chain) == 0 {
+		if ip := parseAddr(r.Header.Get("X-Real-IP")); ip != nil {
+			return ip
+		}
+		return peer
+	}
+
+	client := peer
+	for i := len(chain) - 1; i >= 0; i-- {
+		// an obfuscated or broken hop ends what we can trust
+		if chain[i] == nil {
+			break
+		}
+		client = chain[i]
+		if !contains(res.trusted, client) {
+			break
+		}
+	}
+	return client
+}
+
+// Country returns the CF-IPCountry header Cloudflare sets when a trusted
+// peer sent it, the same rule Resolve follows, and is empty otherwise.
+func (res *IPResolver) Country(r *http.Request) string {
+	peer := parseAddr(r.RemoteAddr)
+	if peer == nil || !contains(res.trusted, peer) {
+		return ""
+	}
+	return r.Header.Get("CF-IPCountry")
+}
+
+// ClientIPMiddleware puts the resolved client address into the ClientIPKey
+// context value and its country into ClientCountryKey.
+func ClientIPMiddleware(res *IPResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := res.Resolve(r); ip != nil {
+				r = r.WithContext(context.WithValue(r.Context(), ClientIPKey, ip.String()))
+			}
+			if country := res.Country(r); country != "" {
+				r = r.WithContext(context.WithValue(r.Context(), ClientCountryKey, country))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the client address resolved by ClientIPMiddleware, or the
+// peer address without it. It is empty when the address cannot be parsed.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIPKey).(string); ok {
+		return ip
+	}
+	if ip := parseAddr(r.RemoteAddr); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// ClientCountry returns the country found by ClientIPMiddleware. It is empty
+// without the middleware or a trusted proxy.
+func ClientCountry(r *http.Request) string {
+	country, _ := r.Context().Value(ClientCountryKey).(string)
+	return country
+}
+
+// IPGroup is the unit one client is counted by: the address for IPv4 and its
+// /64 network for IPv6, as a single host usually gets a whole /64.
+func IPGroup(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+// ParseNetworks parses a list of IPs and CIDRs.
+func ParseNetworks(entries []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", entry)
+			}
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor lists the hops of the RFC 7239 Forwarded header, or of
+// X-Forwarded-For without it, from the client to the last proxy. Hops that
+// are not addresses are nil.
+func forwardedFor(header http.Header) []net.IP {
+	chain := []net.IP{}
+
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			var hop net.IP
+			for _, pair := range strings.Split(element, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(name, "for") {
+					hop = parseAddr(strings.Trim(value, `"`))
+				}
+			}
+			chain = append(chain, hop)
+		}
+		return chain
+	}
+
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			chain = append(chain, parseAddr(strings.TrimSpace(hop)))
+		}
+	}
+	return chain
+}
+
+// parseAddr parses an IP with or without a port, IPv6 in brackets with one.
+func parseAddr(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(strings.Trim(addr, "[]"))
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIPResolver(t *testing.T) {
+	trusted, err := ParseNetworks([]string{"10.0.0.0/8", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("failed to parse networks: %v", err)
+	}
+	resolver := NewIPResolver(trusted)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:4000", expected: "203.0.113.7"},
+		{name: "untrusted peer cannot spoof", remoteAddr: "203.0.113.7:4000", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, expected: "203.0.113.7"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:4000", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "spoofed entry before the real client", remoteAddr: "10.0.0.2:4000", headers: map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1, 10.0.0.3"}, expected: "198.51.100.1"},
+		{name: "only trusted hops", remoteAddr: "10.0.0.2:4000", headers: map[string]string{"X-Forwarded-For": "10.0.0.4, 10.0.0.3"}, expected: "10.0.0.4"},
+		{name: "broken hop", remoteAddr: "10.0.0.2:4000", headers: map[string]string{"X-Forwarded-For": "198.51.100.1, garbage"}, expected: "10.0.0.2"},
+		{name: "x-real-ip", remoteAddr: "10.0.0.2:4000", headers: map[string]string{"X-Real-IP": "198.51.100.1"}, expected: "198.51.100.1"},
+		{name: "forwarded", remoteAddr: "10.0.0.2:4000", headers: map[string]string{"Forwarded": `for=198.51.100.1;proto=https, For="[2001:db8::17]:4711"`}, expected: "2001:db8::17"},
+		{name: "forwarded wins over x-forwarded-for", remoteAddr: "10.0.0.2:4000", headers: map[string]string{"Forwarded": "for=198.51.100.1", "X-Forwarded-For": "198.51.100.2"}, expected: "198.51.100.1"},
+		{name: "obfuscated forwarded", remoteAddr: "10.0.0.2:4000", headers: map[string]string{"Forwarded": "for=_hidden"}, expected: "10.0.0.2"},
+		{name: "trusted ipv6 proxy", remoteAddr: "[fd00::1]:4000", headers: map[string]string{"X-Forwarded-For": "2001:db8::1"}, expected: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			if got := resolver.Resolve(req).String(); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClientIPMiddleware_Country(t *testing.T) {
+	trusted, err := ParseNetworks([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("failed to parse networks: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		expected   string
+	}{
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:4000", expected: "DE"},
+		{name: "untrusted peer cannot spoof", remoteAddr: "203.0.113.7:4000", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := ClientIPMiddleware(NewIPResolver(trusted))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientCountry(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("CF-IPCountry", "DE")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expected {
+				t.Errorf("expected country %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIPGroup(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"203.0.113.7", "203.0.113.7"},
+		{"2001:db8:1:2:aaaa::1", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:bbbb::2", "2001:db8:1:2::/64"},
+		{"::ffff:203.0.113.7", "::ffff:203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		if got := IPGroup(tt.ip); got != tt.expected {
+			t.Errorf("IPGroup(%q) = %q; want %q", tt.ip, got, tt.expected)
+		}
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	if _, err := ParseNetworks([]string{"127.0.0.1", "10.0.0.0/8", "::1"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, entry := range []string{"localhost", "10.0.0.0/33"} {
+		if _, err := ParseNetworks([]string{entry}); err == nil {
+			t.Errorf("expected an error for %q", entry)
+		}
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	var out bytes.Buffer
+	handler := ClientIPMiddleware(NewIPResolver(nil))(AccessLogMiddleware(log.New(&out, "", 0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusFound)
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	req.RemoteAddr = "203.0.113.7:4000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.HasPrefix(out.String(), "203.0.113.7 GET /abc123 302 ") {
+		t.Errorf("unexpected access log line %q", out.String())
+	}
+}
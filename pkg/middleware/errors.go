@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// ErrorWriter answers a request the middleware rejects. code names the
+// error for machines, e.g. "unauthorized" or "rate_limited".
+type ErrorWriter func(w http.ResponseWriter, status int, code, message string)
+
+const errorWriterKey = contextKey("error_writer")
+
+// ErrorWriterMiddleware has the middleware further down answer with write
+// instead of a plain text body.
+func ErrorWriterMiddleware(write ErrorWriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), errorWriterKey, write)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if write, ok := r.Context().Value(errorWriterKey).(ErrorWriter); ok {
+		write(w, status, code, message)
+		return
+	}
+	http.Error(w, message, status)
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultInitDataMaxAge is how long a Mini App launch stays valid.
+const DefaultInitDataMaxAge = 24 * time.Hour
+
+// initDataClockSkew is how far auth_date may lie ahead of the local clock.
+const initDataClockSkew = time.Minute
+
+var (
+	errInitDataSignature = errors.New("invalid initData signature")
+	errInitDataExpired   = errors.New("initData has expired")
+	errInitDataFuture    = errors.New("initData is from the future")
+	errInitDataUser      = errors.New("initData has no user")
+)
+
+// InitDataMiddleware verifies the Mini App initData AuthSchemeMiddleware
+// passes on and puts the user ID into TelegramIDKey.
+func InitDataMiddleware(botToken string, maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			initData := credentials(r)
+			if initData == "" {
+				writeError(w, r, http.StatusUnauthorized, "unauthorized", "Missing initData")
+				return
+			}
+
+			telegramID, err := validateInitData(initData, botToken, maxAge, time.Now())
+			if err != nil {
+				writeError(w, r, http.StatusUnauthorized, "unauthorized", err.Error())
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), TelegramIDKey, telegramID)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// validateInitData checks initData as described in
+// https://core.telegram.org/bots/webapps#validating-data-received-via-the-mini-app
+// and returns the ID of the user who opened the app.
+func validateInitData(initData, botToken string, maxAge time.Duration, now time.Time) (int64, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return 0, errInitDataSignature
+	}
+
+	hash := values.Get("hash")
+	values.Del("hash")
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + values.Get(key)
+	}
+
+	expected, err := hex.DecodeString(hash)
+	if err != nil || !hmac.Equal(signInitData(strings.Join(pairs, "\n"), botToken), expected) {
+		return 0, errInitDataSignature
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil || now.Sub(time.Unix(authDate, 0)) > maxAge {
+		return 0, errInitDataExpired
+	}
+	if time.Unix(authDate, 0).Sub(now) > initDataClockSkew {
+		return 0, errInitDataFuture
+	}
+
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(values.Get("user")), &user); err != nil || user.ID == 0 {
+		return 0, errInitDataUser
+	}
+	return user.ID, nil
+}
+
+func signInitData(dataCheckString, botToken string) []byte {
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(dataCheckString))
+	return mac.Sum(nil)
+}
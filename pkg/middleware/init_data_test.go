@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBotToken = "123456:ABC-DEF"
+
+func signedInitData(fields map[string]string, botToken string) string {
+	keys := []string{}
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	values := url.Values{}
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+fields[key])
+		values.Set(key, fields[key])
+	}
+	values.Set("hash", hex.EncodeToString(signInitData(strings.Join(pairs, "\n"), botToken)))
+	return values.Encode()
+}
+
+func TestInitDataMiddleware(t *testing.T) {
+	fresh := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-2*DefaultInitDataMaxAge).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	user := `{"id":42,"first_name":"Ann","username":"ann"}`
+
+	valid := signedInitData(map[string]string{"auth_date": fresh, "query_id": "AAH", "user": user}, testBotToken)
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedID     int64
+	}{
+		{name: "valid initData", authorization: "tma " + valid, expectedStatus: http.StatusOK, expectedID: 42},
+		{name: "tampered user", authorization: "tma " + strings.Replace(valid, "ann", "bob", 1), expectedStatus: http.StatusUnauthorized},
+		{name: "other bot token", authorization: "tma " + signedInitData(map[string]string{"auth_date": fresh, "user": user}, "654321:XYZ"), expectedStatus: http.StatusUnauthorized},
+		{name: "expired", authorization: "tma " + signedInitData(map[string]string{"auth_date": stale, "user": user}, testBotToken), expectedStatus: http.StatusUnauthorized},
+		{name: "from the future", authorization: "tma " + signedInitData(map[string]string{"auth_date": future, "user": user}, testBotToken), expectedStatus: http.StatusUnauthorized},
+		{name: "uppercase scheme", authorization: "TMA " + valid, expectedStatus: http.StatusOK, expectedID: 42},
+		{name: "without user", authorization: "tma " + signedInitData(map[string]string{"auth_date": fresh}, testBotToken), expectedStatus: http.StatusUnauthorized},
+		{name: "without hash", authorization: "tma auth_date=" + fresh, expectedStatus: http.StatusUnauthorized},
+		{name: "missing header", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotID int64
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotID = r.Context().Value(TelegramIDKey).(int64)
+			})
+			handler := AuthSchemeMiddleware(map[string]func(http.Handler) http.Handler{
+				"tma": InitDataMiddleware(testBotToken, DefaultInitDataMaxAge),
+			})(next)
+
+			req := httptest.NewRequest(http.MethodGet, "/stats/abc", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d (%s)", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if gotID != tt.expectedID {
+				t.Errorf("expected telegram id %d, got %d", tt.expectedID, gotID)
+			}
+		})
+	}
+}
+
+func TestAuthSchemeMiddleware(t *testing.T) {
+	initData := signedInitData(map[string]string{"auth_date": strconv.FormatInt(time.Now().Unix(), 10), "user": `{"id":7}`}, testBotToken)
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedID     int64
+	}{
+		{name: "api key", authorization: "Bearer usb_valid", expectedStatus: http.StatusOK, expectedID: 42},
+		{name: "mini app", authorization: "tma " + initData, expectedStatus: http.StatusOK, expectedID: 7},
+		{name: "unknown scheme", authorization: "Basic dXNlcjpwYXNz", expectedStatus: http.StatusUnauthorized},
+		{name: "no credentials", expectedStatus: http.StatusUnauthorized},
+	}
+
+	auth := AuthSchemeMiddleware(map[string]func(http.Handler) http.Handler{
+		"Bearer": ApiKeyMiddleware(&mockResolver{keys: map[string]int64{"usb_valid": 42}}, ""),
+		"tma":    InitDataMiddleware(testBotToken, DefaultInitDataMaxAge),
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotID int64
+			handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotID = r.Context().Value(TelegramIDKey).(int64)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/stats/abc", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if gotID != tt.expectedID {
+				t.Errorf("expected telegram id %d, got %d", tt.expectedID, gotID)
+			}
+		})
+	}
+}
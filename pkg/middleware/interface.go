@@ -0,0 +1,13 @@
+package middleware
+
+// KeyResolver maps an API key to the Telegram ID of its owner.
+type KeyResolver interface {
+	Resolve(key string) (int64, error)
+}
+
+// LimiterStore keeps the request counts of the rate limiter.
+type LimiterStore interface {
+	// Take counts one request of key under policy and reports whether it is
+	// allowed.
+	Take(key string, policy Policy) (Decision, error)
+}
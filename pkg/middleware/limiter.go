@@ -1,77 +1,112 @@
 package middleware
 
 import (
+	"log"
+	"math"
 	"net"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
+	"url-shorter-bot/pkg/metrics"
 
 	"golang.org/x/time/rate"
 )
 
-type visitor struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
-}
-
-var (
-	visitors = make(map[string]*visitor)
-	mu       sync.Mutex
+// Identities a Policy can count requests by.
+const (
+	KeyIP         = "ip"
+	KeyTelegramID = "telegram_id"
+	KeyApiKey     = "api_key"
 )
 
-func GetVisitor(ip string) *rate.Limiter {
-	mu.Lock()
-	defer mu.Unlock()
+// Policy allows Requests per Period to every identity, with bursts of up to
+// Burst requests. Requests of zero or less lift the limit.
+type Policy struct {
+	Name     string
+	Requests int
+	Period   time.Duration
+	Burst    int
+	Key      string
+}
 
-	v, exists := visitors[ip]
-	if !exists {
-		limiter := rate.NewLimiter(2.0/30.0, 2)
-		visitors[ip] = &visitor{limiter, time.Now()}
-		return limiter
-	}
+func (p Policy) limit() rate.Limit {
+	return rate.Limit(float64(p.Requests) / p.Period.Seconds())
+}
 
-	v.lastSeen = time.Now()
-	return v.limiter
+// Decision is the answer of a LimiterStore.
+type Decision struct {
+	Allowed    bool
+	Limit      int           // requests allowed at once
+	Remaining  int           // requests left right now
+	Reset      time.Duration // until the count is back to zero
+	RetryAfter time.Duration // until a rejected request may be retried
 }
 
-func CleanupVisitors(testing ...string) {
-	if len(testing) > 0 && testing[0] == "testing" {
-		mu.Lock()
-		defer mu.Unlock()
-		for ip, v := range visitors {
-			if time.Since(v.lastSeen) > 3*time.Minute {
-				delete(visitors, ip)
-			}
+// RateLimitMiddleware enforces policy with the counts in store and reports the state of the caller's
+// bucket in X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset
+// (seconds until the bucket is full again). Rejected requests get a
+// Retry-After. Callers from allowlist are not limited.
+//
+// Policies keyed by Telegram ID or API key must run after the authentication,
+// callers without the verified identity of the policy are counted by IPGroup
+// of ClientIP.
+func RateLimitMiddleware(store LimiterStore, policy Policy, allowlist []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if policy.Requests <= 0 {
+			return next
 		}
-	} else {
-		for {
-			time.Sleep(time.Minute)
 
-			mu.Lock()
-			for ip, v := range visitors {
-				if time.Since(v.lastSeen) > 3*time.Minute {
-					delete(visitors, ip)
-				}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIP(r)
+			if ip == "" {
+				writeError(w, r, http.StatusInternalServerError, "internal_error", "Server Error")
+				return
 			}
-			mu.Unlock()
-		}
+			if contains(allowlist, net.ParseIP(ip)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			decision, err := store.Take(visitorKey(r, policy.Key, ip), policy)
+			if err != nil {
+				// an unavailable store must not take the service down
+				log.Printf("rate limiter: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(decision.Reset)))
+
+			if !decision.Allowed {
+				metrics.RateLimited.Inc(policy.Name)
+				w.Header().Set("Retry-After", strconv.Itoa(seconds(decision.RetryAfter)))
+				writeError(w, r, http.StatusTooManyRequests, "rate_limited", "Too Many Requests")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
 	}
 }
 
-func RateLimitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			http.Error(w, "Server Error", http.StatusInternalServerError)
-			return
+// visitorKey names the identity a request is counted by.
+func visitorKey(r *http.Request, key, ip string) string {
+	switch key {
+	case KeyTelegramID:
+		if telegramID, ok := r.Context().Value(TelegramIDKey).(int64); ok {
+			return "tg:" + strconv.FormatInt(telegramID, 10)
 		}
-
-		limiter := GetVisitor(ip)
-		if !limiter.Allow() {
-			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-			return
+	case KeyApiKey:
+		if digest, ok := r.Context().Value(ApiKeyKey).(string); ok {
+			return "key:" + digest
 		}
+	}
+	return "ip:" + IPGroup(ip)
+}
 
-		next.ServeHTTP(w, r)
-	})
+// seconds rounds d up to whole seconds for the headers.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
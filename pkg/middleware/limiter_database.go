@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+	"url-shorter-bot/pkg/database"
+)
+
+// DatabaseStore shares the counts of every instance through the
+// rate_limit_hits table. A request is allowed while fewer than Requests
+// requests of its key were allowed within the sliding window of the last
+// Period; Burst does not apply. The take_rate_limit_hit function counts and
+// records a hit in one round trip and serializes the requests of a key, so
+// the limit holds under concurrency.
+type DatabaseStore struct {
+	db  database.SupabaseClient
+	now func() time.Time
+}
+
+// NewDatabaseStore reads the time from now, time.Now when nil.
+func NewDatabaseStore(db database.SupabaseClient, now func() time.Time) *DatabaseStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &DatabaseStore{db: db, now: now}
+}
+
+func (s *DatabaseStore) Take(key string, policy Policy) (Decision, error) {
+	now := s.now().UTC()
+	key = hitKey(key, policy)
+
+	body, err := s.db.Rpc("take_rate_limit_hit", map[string]interface{}{
+		"hit_key":        key,
+		"max_hits":       policy.Requests,
+		"window_seconds": policy.Period.Seconds(),
+		"at":             now.Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+
+	var rows []struct {
+		Allowed bool       `json:"allowed"`
+		Hits    int        `json:"hits"`
+		Oldest  *time.Time `json:"oldest"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return Decision{}, err
+	}
+	if len(rows) != 1 {
+		return Decision{}, fmt.Errorf("take_rate_limit_hit returned %d rows", len(rows))
+	}
+	hit := rows[0]
+
+	decision := Decision{Allowed: hit.Allowed, Limit: policy.Requests, Reset: policy.Period}
+	if hit.Allowed {
+		decision.Remaining = policy.Requests - hit.Hits - 1
+	} else if hit.Oldest != nil {
+		// the oldest hit leaves the window first
+		decision.RetryAfter = hit.Oldest.Add(policy.Period).Sub(now)
+	}
+	return decision, nil
+}
+
+// Run deletes hits that left their window every minute until ctx is done.
+func (s *DatabaseStore) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := s.cleanup(); err != nil {
+				log.Printf("rate limit cleanup failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *DatabaseStore) cleanup() error {
+	_, err := s.db.Delete("rate_limit_hits", "Expires_at=lt."+s.now().UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+// hitKey is a digest of the key, so no IPs or credentials are stored.
+func hitKey(key string, policy Policy) string {
+	sum := sha256.Sum256([]byte(policy.Name + "|" + key))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+	refill   time.Duration // until an unused bucket is full again
+}
+
+// MemoryStore keeps a token bucket per key in this process. Policies allow
+// bursts of Burst requests and refill at Requests per Period.
+type MemoryStore struct {
+	now      func() time.Time
+	mu       sync.Mutex
+	visitors map[string]*visitor
+}
+
+// NewMemoryStore reads the time from now, time.Now when nil.
+func NewMemoryStore(now func() time.Time) *MemoryStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryStore{now: now, visitors: make(map[string]*visitor)}
+}
+
+func (s *MemoryStore) Take(key string, policy Policy) (Decision, error) {
+	now := s.now()
+	limiter := s.limiter(key, policy, now)
+
+	reservation := limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	allowed := reservation.OK() && delay == 0
+	if !allowed {
+		reservation.CancelAt(now)
+	}
+
+	tokens := math.Max(limiter.TokensAt(now), 0)
+	reset := (float64(policy.Burst) - tokens) / float64(policy.limit())
+
+	return Decision{
+		Allowed:    allowed,
+		Limit:      policy.Burst,
+		Remaining:  int(tokens),
+		Reset:      time.Duration(reset * float64(time.Second)),
+		RetryAfter: delay,
+	}, nil
+}
+
+func (s *MemoryStore) limiter(key string, policy Policy, now time.Time) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key = policy.Name + "|" + key
+	v, exists := s.visitors[key]
+	if !exists {
+		refill := time.Duration(float64(policy.Burst) / float64(policy.limit()) * float64(time.Second))
+		v = &visitor{limiter: rate.NewLimiter(policy.limit(), policy.Burst), refill: refill}
+		s.visitors[key] = v
+	}
+	v.lastSeen = now
+	return v.limiter
+}
+
+// Run forgets visitors whose buckets are full again every minute until ctx
+// is done.
+func (s *MemoryStore) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.cleanup()
+		}
+	}
+}
+
+func (s *MemoryStore) cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, v := range s.visitors {
+		// a new bucket starts full, so only full ones can be dropped
+		if s.now().Sub(v.lastSeen) > v.refill {
+			delete(s.visitors, key)
+		}
+	}
+}
@@ -1,111 +1,306 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+	"url-shorter-bot/pkg/database"
 )
 
-func TestGetVisitor_NewAndExisting(t *testing.T) {
-	ip := "203.0.113.1"
-	lim1 := GetVisitor(ip)
-	if lim1 == nil {
-		t.Fatal("Expected limiter, got nil")
-	}
-
-	lim2 := GetVisitor(ip)
-	if lim2 != lim1 {
-		t.Error("Expected the same limiter instance for same IP")
-	}
+type fakeClock struct {
+	now time.Time
 }
 
-func TestCleanupVisitors(t *testing.T) {
-	ip := "198.51.100.1"
-	GetVisitor(ip)
-
-	mu.Lock()
-	visitors[ip].lastSeen = time.Now().Add(-3 * time.Minute)
-	mu.Unlock()
-
-	CleanupVisitors("testing")
-
-	mu.Lock()
-	_, exists := visitors[ip]
-	mu.Unlock()
-
-	if exists {
-		t.Error("Visitor should have been cleaned up")
-	}
+func (c *fakeClock) Now() time.Time {
+	return c.now
 }
 
-func TestGetVisitor(t *testing.T) {
-	tests := []struct {
-		name string
-		ip   string
-	}{
-		{"Normal IP", "192.168.0.1"},
-		{"Another IP", "10.0.0.1"},
-		{"Empty IP", ""},
-	}
+type failingStore struct{}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			lim := GetVisitor(tt.ip)
-			if lim == nil {
-				t.Errorf("Expected nil limiter for IP %q", tt.ip)
-			}
-		})
-	}
+func (failingStore) Take(key string, policy Policy) (Decision, error) {
+	return Decision{}, errors.New("database is down")
 }
 
+var testPolicy = Policy{Name: "test", Requests: 2, Period: 30 * time.Second, Burst: 2, Key: KeyIP}
+
 func TestRateLimitMiddleware(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	allowlist, err := ParseNetworks([]string{"10.1.0.0/16", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("failed to parse allowlist: %v", err)
+	}
+
 	tests := []struct {
-		name           string
-		ip             string
-		requests       int
-		expectedStatus int
+		name              string
+		policy            Policy
+		ip                string
+		rotateIPv6        bool
+		telegramID        int64
+		authorization     []string
+		apiKeys           []string
+		requests          int
+		expectedStatus    int
+		expectedRemaining string
 	}{
 		{
-			name:           "Under limit first",
-			ip:             "192.0.2.1",
-			requests:       1,
+			name:              "Under limit first",
+			policy:            testPolicy,
+			ip:                "192.0.2.1",
+			requests:          1,
+			expectedStatus:    http.StatusOK,
+			expectedRemaining: "1",
+		},
+		{
+			name:              "Under limit second",
+			policy:            testPolicy,
+			ip:                "192.0.2.1",
+			requests:          2,
+			expectedStatus:    http.StatusOK,
+			expectedRemaining: "0",
+		},
+		{
+			name:              "Over limit",
+			policy:            testPolicy,
+			ip:                "192.0.2.2",
+			requests:          3,
+			expectedStatus:    http.StatusTooManyRequests,
+			expectedRemaining: "0",
+		},
+		{
+			name:           "Allowlisted network",
+			policy:         testPolicy,
+			ip:             "10.1.2.3",
+			requests:       5,
 			expectedStatus: http.StatusOK,
 		},
 		{
-			name:           "Under limit second",
-			ip:             "192.0.2.1",
-			requests:       1,
+			name:           "Allowlisted IPv6",
+			policy:         testPolicy,
+			ip:             "2001:db8::1",
+			requests:       5,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:              "IPv6 addresses of one /64 share a bucket",
+			policy:            testPolicy,
+			ip:                "2001:db8:5:6::1",
+			rotateIPv6:        true,
+			requests:          3,
+			expectedStatus:    http.StatusTooManyRequests,
+			expectedRemaining: "0",
+		},
+		{
+			name:           "Unlimited policy",
+			policy:         Policy{Name: "unlimited", Requests: -1},
+			ip:             "192.0.2.3",
+			requests:       5,
 			expectedStatus: http.StatusOK,
 		},
 		{
-			name:           "Over limit",
-			ip:             "192.0.2.2",
-			requests:       3,
-			expectedStatus: http.StatusTooManyRequests,
+			name:              "Telegram ID shares one bucket across IPs",
+			policy:            Policy{Name: "create", Requests: 2, Period: time.Minute, Burst: 2, Key: KeyTelegramID},
+			ip:                "192.0.2.4",
+			telegramID:        42,
+			requests:          3,
+			expectedStatus:    http.StatusTooManyRequests,
+			expectedRemaining: "0",
+		},
+		{
+			name:              "API keys get separate buckets",
+			policy:            Policy{Name: "api", Requests: 2, Period: time.Minute, Burst: 2, Key: KeyApiKey},
+			ip:                "192.0.2.5",
+			apiKeys:           []string{"digest-one", "digest-one", "digest-two"},
+			requests:          3,
+			expectedStatus:    http.StatusOK,
+			expectedRemaining: "1",
+		},
+		{
+			name:              "Unverified API keys count by IP",
+			policy:            Policy{Name: "api", Requests: 2, Period: time.Minute, Burst: 2, Key: KeyApiKey},
+			ip:                "192.0.2.6",
+			authorization:     []string{"Bearer usb_one", "Bearer usb_two", "Bearer usb_three"},
+			requests:          3,
+			expectedStatus:    http.StatusTooManyRequests,
+			expectedRemaining: "0",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mw := RateLimitMiddleware(handler)
-			var finalCode int
+			mw := RateLimitMiddleware(NewMemoryStore(nil), tt.policy, allowlist)(handler)
+			var rec *httptest.ResponseRecorder
 
 			for i := 0; i < tt.requests; i++ {
-				rec := httptest.NewRecorder()
+				rec = httptest.NewRecorder()
 				req := httptest.NewRequest("GET", "/", nil)
-				req.RemoteAddr = tt.ip + ":12345"
+				req.RemoteAddr = net.JoinHostPort(tt.ip, "12345")
+				if tt.rotateIPv6 {
+					req.RemoteAddr = net.JoinHostPort(fmt.Sprintf("2001:db8:5:6::%x", 10+i), "12345")
+				}
+				if tt.telegramID != 0 {
+					// a new address per request must not reset the bucket
+					req.RemoteAddr = fmt.Sprintf("192.0.2.%d:12345", 10+i)
+					req = req.WithContext(context.WithValue(req.Context(), TelegramIDKey, tt.telegramID))
+				}
+				if tt.authorization != nil {
+					req.Header.Set("Authorization", tt.authorization[i])
+				}
+				if tt.apiKeys != nil {
+					req = req.WithContext(context.WithValue(req.Context(), ApiKeyKey, tt.apiKeys[i]))
+				}
 				mw.ServeHTTP(rec, req)
-				finalCode = rec.Code
 			}
 
-			if finalCode != tt.expectedStatus {
-				t.Errorf("Final response code = %d; want %d", finalCode, tt.expectedStatus)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Final response code = %d; want %d", rec.Code, tt.expectedStatus)
+			}
+			if got := rec.Header().Get("X-RateLimit-Remaining"); got != tt.expectedRemaining {
+				t.Errorf("X-RateLimit-Remaining = %q; want %q", got, tt.expectedRemaining)
+			}
+			if tt.expectedStatus == http.StatusTooManyRequests {
+				if rec.Header().Get("Retry-After") == "" || rec.Header().Get("X-RateLimit-Reset") == "" {
+					t.Errorf("expected Retry-After and X-RateLimit-Reset, got %v", rec.Header())
+				}
 			}
 		})
 	}
 }
+
+func TestRateLimitMiddleware_StoreFailure(t *testing.T) {
+	mw := RateLimitMiddleware(failingStore{}, testPolicy, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	mw.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the request to pass when the store fails, got %d", rec.Code)
+	}
+}
+
+func TestLimiterStores(t *testing.T) {
+	policy := Policy{Name: "test", Requests: 2, Period: 30 * time.Second, Burst: 2, Key: KeyIP}
+
+	newStores := map[string]func(t *testing.T, clock *fakeClock) LimiterStore{
+		"memory": func(t *testing.T, clock *fakeClock) LimiterStore {
+			return NewMemoryStore(clock.Now)
+		},
+		"database": func(t *testing.T, clock *fakeClock) LimiterStore {
+			db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "limits.db"))
+			if err != nil {
+				t.Fatalf("failed to open sqlite: %v", err)
+			}
+			return NewDatabaseStore(db, clock.Now)
+		},
+	}
+
+	steps := []struct {
+		advance    time.Duration
+		key        string
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{key: "a", allowed: true, remaining: 1},
+		{key: "a", allowed: true, remaining: 0},
+		{key: "a", allowed: false, remaining: 0, retryAfter: 30 * time.Second},
+		{key: "b", allowed: true, remaining: 1},
+		{advance: 30 * time.Second, key: "a", allowed: true, remaining: 1},
+		{key: "a", allowed: true, remaining: 0},
+		{key: "a", allowed: false, remaining: 0, retryAfter: 30 * time.Second},
+	}
+
+	for name, newStore := range newStores {
+		t.Run(name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+			store := newStore(t, clock)
+
+			for i, step := range steps {
+				clock.now = clock.now.Add(step.advance)
+				decision, err := store.Take(step.key, policy)
+				if err != nil {
+					t.Fatalf("step %d: unexpected error: %v", i, err)
+				}
+				if decision.Allowed != step.allowed || decision.Remaining != step.remaining {
+					t.Errorf("step %d: expected allowed=%v remaining=%d, got %+v", i, step.allowed, step.remaining, decision)
+				}
+				if step.retryAfter > 0 && (decision.RetryAfter <= 0 || decision.RetryAfter > step.retryAfter) {
+					t.Errorf("step %d: expected retry within %s, got %s", i, step.retryAfter, decision.RetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabaseStore_Concurrent(t *testing.T) {
+	db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "limits.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	store := NewDatabaseStore(db, nil)
+	policy := Policy{Name: "test", Requests: 5, Period: time.Minute, Key: KeyIP}
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decision, err := store.Take("a", policy)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if decision.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != int32(policy.Requests) {
+		t.Errorf("expected %d concurrent requests allowed, got %d", policy.Requests, got)
+	}
+}
+
+func TestMemoryStore_Cleanup(t *testing.T) {
+	hourly := Policy{Name: "hourly", Requests: 1, Period: time.Hour, Burst: 2, Key: KeyIP}
+
+	clock := &fakeClock{now: time.Now()}
+	store := NewMemoryStore(clock.Now)
+	store.Take("198.51.100.1", testPolicy)
+	store.Take("198.51.100.1", hourly)
+
+	clock.now = clock.now.Add(2 * time.Minute)
+	store.Take("198.51.100.2", testPolicy)
+
+	clock.now = clock.now.Add(15 * time.Second)
+	store.cleanup()
+
+	if _, exists := store.visitors[testPolicy.Name+"|198.51.100.1"]; exists {
+		t.Error("visitor with a full bucket should have been cleaned up")
+	}
+	if _, exists := store.visitors[testPolicy.Name+"|198.51.100.2"]; !exists {
+		t.Error("recent visitor should have been kept")
+	}
+	if _, exists := store.visitors[hourly.Name+"|198.51.100.1"]; !exists {
+		t.Error("visitor of a slow policy should be kept until the bucket is full")
+	}
+
+	// dropping the bucket must not hand out a fresh one early
+	store.Take("198.51.100.1", hourly)
+	if decision, _ := store.Take("198.51.100.1", hourly); decision.Allowed {
+		t.Errorf("expected the hourly bucket to be empty, got %+v", decision)
+	}
+}
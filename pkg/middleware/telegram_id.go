@@ -14,13 +14,13 @@ func TelegramIDMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		telegramIDStr := r.Header.Get("X-Telegram-ID")
 		if telegramIDStr == "" {
-			http.Error(w, "Missing X-Telegram-ID header", http.StatusUnauthorized)
+			writeError(w, r, http.StatusUnauthorized, "unauthorized", "Missing X-Telegram-ID header")
 			return
 		}
 
 		telegramID, err := strconv.ParseInt(telegramIDStr, 10, 64)
 		if err != nil {
-			http.Error(w, "Invalid X-Telegram-ID", http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, "invalid_request", "Invalid X-Telegram-ID")
 			return
 		}
 
@@ -0,0 +1,11 @@
+package migration
+
+// Executor runs SQL on the database. A call runs in one transaction.
+type Executor interface {
+	Exec(sql string) error
+}
+
+// Selecter reads the schema_migrations table.
+type Selecter interface {
+	Select(table string, query string) ([]byte, error)
+}
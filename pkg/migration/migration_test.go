@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"url-shorter-bot/pkg/models"
 )
 
 type testMigrator struct {
@@ -151,14 +150,14 @@ func TestCreateTable(t *testing.T) {
 	}{
 		{
 			table:       "name",
-			query:       models.SqlRequests["urls"],
+			query:       `CREATE TABLE IF NOT EXISTS urls (uuid uuid PRIMARY KEY);`,
 			name:        "success",
 			statusCode:  200,
 			expectError: false,
 		},
 		{
 			table:       "name",
-			query:       models.SqlRequests["urls"],
+			query:       `CREATE TABLE IF NOT EXISTS urls (uuid uuid PRIMARY KEY);`,
 			name:        "supabase returns error",
 			statusCode:  500,
 			expectError: true,
@@ -75,8 +75,10 @@ func (m *SupabaseMigrator) TableExists(tableName string) (bool, error) {
 	return exists, nil
 }
 
-func (m *SupabaseMigrator) CreateTable(table, request string) error {
-	payload := map[string]string{"sql": request}
+// Exec runs sql through the execute_sql function. The function body is one
+// transaction, so a failing statement rolls back the whole call.
+func (m *SupabaseMigrator) Exec(sql string) error {
+	payload := map[string]string{"sql": sql}
 	body, _ := json.Marshal(payload)
 
 	url := fmt.Sprintf("%s/rest/v1/rpc/execute_sql", m.ProjectUrl)
@@ -94,7 +96,9 @@ func (m *SupabaseMigrator) CreateTable(table, request string) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 && resp.StatusCode != 201 && resp.StatusCode != 204 {
-		return fmt.Errorf("failed to create table %s: %s", table, resp.Status)
+		var errResp map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		return fmt.Errorf("execute_sql failed: %v (status %d)", errResp["message"], resp.StatusCode)
 	}
 	return nil
 }
@@ -0,0 +1,320 @@
+package migration
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"url-shorter-bot/pkg/database"
+)
+
+var (
+	ErrLocked           = errors.New("migrations are locked by another run")
+	ErrChecksumMismatch = errors.New("applied migration was changed")
+	ErrNoDown           = errors.New("migration has no down script")
+)
+
+// Migration states reported by Status.
+const (
+	StateApplied  = "applied"
+	StatePending  = "pending"
+	StateModified = "modified" // applied, but the file changed since
+	StateMissing  = "missing"  // applied, but the file is gone
+)
+
+// staleLock is how long a lock of a crashed run blocks other runs.
+const staleLock = 10 * time.Minute
+
+// timeLayout sorts as text, which the lock expiry relies on.
+const timeLayout = "2006-01-02T15:04:05.000Z"
+
+// bootstrap creates the tables of the runner itself. Only portable SQL, so
+// the runner can be tested on SQLite.
+const bootstrap = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    owner TEXT NOT NULL,
+    locked_at TIMESTAMPTZ NOT NULL
+);
+`
+
+// AppliedMigration is a row of schema_migrations.
+type AppliedMigration struct {
+	Version    int       `json:"version"`
+	Name       string    `json:"name"`
+	Checksum   string    `json:"checksum"`
+	Applied_at time.Time `json:"applied_at"`
+}
+
+// Status is the state of one migration.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Runner applies and reverts migrations and records them in
+// schema_migrations. Runs of several instances are serialized through a row
+// in schema_migrations_lock.
+type Runner struct {
+	exec       Executor
+	db         Selecter
+	migrations []Migration
+	out        io.Writer
+	owner      string
+
+	// DryRun prints the SQL of Up and Down instead of running it.
+	DryRun bool
+	// LockWait is how long to wait for another run to finish.
+	LockWait time.Duration
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRunner runs migrations with exec and reads the applied ones with db.
+// Progress is written to out.
+func NewRunner(exec Executor, db Selecter, migrations []Migration, out io.Writer) *Runner {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	return &Runner{
+		exec:       exec,
+		db:         db,
+		migrations: migrations,
+		out:        out,
+		owner:      fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix)),
+		LockWait:   time.Minute,
+		now:        time.Now,
+		sleep:      time.Sleep,
+	}
+}
+
+// Status lists every known or applied migration by version. It only reads,
+// a database without schema_migrations has every migration pending.
+func (r *Runner) Status() ([]Status, error) {
+	applied, err := r.readApplied()
+	if errors.Is(err, database.ErrNoTable) {
+		applied, err = map[int]AppliedMigration{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.status(applied), nil
+}
+
+// Up applies the pending migrations up to version target, all of them when
+// target is 0. It refuses to run while an applied migration was changed or
+// removed.
+func (r *Runner) Up(target int) ([]Migration, error) {
+	return r.run(func(applied map[int]AppliedMigration) ([]Migration, error) {
+		for _, s := range r.status(applied) {
+			switch s.State {
+			case StateModified:
+				return nil, fmt.Errorf("%w: %04d_%s", ErrChecksumMismatch, s.Version, s.Name)
+			case StateMissing:
+				return nil, fmt.Errorf("applied migration %04d_%s is missing", s.Version, s.Name)
+			}
+		}
+
+		pending := []Migration{}
+		for _, m := range r.migrations {
+			if _, ok := applied[m.Version]; !ok && (target == 0 || m.Version <= target) {
+				pending = append(pending, m)
+			}
+		}
+
+		for _, m := range pending {
+			record := fmt.Sprintf("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (%d, '%s', '%s', '%s');",
+				m.Version, m.Name, m.Checksum(), r.now().UTC().Format(timeLayout))
+			if err := r.apply("up", m, m.Up, record); err != nil {
+				return nil, err
+			}
+		}
+		return pending, nil
+	})
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (r *Runner) Down(steps int) ([]Migration, error) {
+	return r.run(func(applied map[int]AppliedMigration) ([]Migration, error) {
+		byVersion := map[int]Migration{}
+		for _, m := range r.migrations {
+			byVersion[m.Version] = m
+		}
+
+		reverted := []Migration{}
+		statuses := r.status(applied)
+		for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+			if statuses[i].State == StatePending {
+				continue
+			}
+
+			m, ok := byVersion[statuses[i].Version]
+			if !ok || m.Down == "" {
+				return reverted, fmt.Errorf("%w: %04d_%s", ErrNoDown, statuses[i].Version, statuses[i].Name)
+			}
+
+			record := fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %d;", m.Version)
+			if err := r.apply("down", m, m.Down, record); err != nil {
+				return reverted, err
+			}
+			reverted = append(reverted, m)
+		}
+		return reverted, nil
+	})
+}
+
+// run prepares the tables, holds the lock and hands the applied migrations
+// to change. A dry run takes no lock and changes nothing.
+func (r *Runner) run(change func(applied map[int]AppliedMigration) ([]Migration, error)) ([]Migration, error) {
+	if r.DryRun {
+		applied, err := r.applied()
+		if err != nil {
+			fmt.Fprintf(r.out, "-- schema_migrations is not readable (%v), assuming a fresh database\n", err)
+			applied = map[int]AppliedMigration{}
+		}
+		return change(applied)
+	}
+
+	if err := r.exec.Exec(bootstrap); err != nil {
+		return nil, err
+	}
+	if err := r.lock(); err != nil {
+		return nil, err
+	}
+	defer r.unlock()
+
+	applied, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+	return change(applied)
+}
+
+// apply runs script together with the schema_migrations record, so both
+// commit or fail together.
+func (r *Runner) apply(direction string, m Migration, script, record string) error {
+	sql := strings.TrimRight(strings.TrimSpace(script), ";") + ";\n" + record
+
+	if r.DryRun {
+		fmt.Fprintf(r.out, "-- %s %04d_%s\n%s\n", direction, m.Version, m.Name, sql)
+		return nil
+	}
+
+	if err := r.exec.Exec(sql); err != nil {
+		return fmt.Errorf("%s %04d_%s: %w", direction, m.Version, m.Name, err)
+	}
+	fmt.Fprintf(r.out, "%s %04d_%s\n", direction, m.Version, m.Name)
+	return nil
+}
+
+func (r *Runner) applied() (map[int]AppliedMigration, error) {
+	var applied map[int]AppliedMigration
+	var err error
+
+	// PostgREST picks up a new schema_migrations table with a short delay
+	for attempt := 0; attempt < 5; attempt++ {
+		if applied, err = r.readApplied(); err == nil {
+			break
+		}
+		if r.DryRun {
+			return nil, err
+		}
+		r.sleep(time.Second)
+	}
+	return applied, err
+}
+
+// readApplied reads schema_migrations once.
+func (r *Runner) readApplied() (map[int]AppliedMigration, error) {
+	body, err := r.db.Select("schema_migrations", "order=version.asc")
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []AppliedMigration
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]AppliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// status merges the known and the applied migrations by version.
+func (r *Runner) status(applied map[int]AppliedMigration) []Status {
+	statuses := []Status{}
+	known := map[int]bool{}
+
+	for _, m := range r.migrations {
+		known[m.Version] = true
+		s := Status{Version: m.Version, Name: m.Name, State: StatePending}
+		if row, ok := applied[m.Version]; ok {
+			appliedAt := row.Applied_at
+			s.AppliedAt = &appliedAt
+			s.State = StateApplied
+			if row.Checksum != m.Checksum() {
+				s.State = StateModified
+			}
+		}
+		statuses = append(statuses, s)
+	}
+
+	for _, row := range applied {
+		if !known[row.Version] {
+			appliedAt := row.Applied_at
+			statuses = append(statuses, Status{Version: row.Version, Name: row.Name, State: StateMissing, AppliedAt: &appliedAt})
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses
+}
+
+// lock inserts the only row of schema_migrations_lock, waiting up to LockWait
+// while another run holds it.
+func (r *Runner) lock() error {
+	deadline := r.now().Add(r.LockWait)
+
+	for {
+		// a crashed run leaves its lock behind
+		r.exec.Exec(fmt.Sprintf("DELETE FROM schema_migrations_lock WHERE locked_at < '%s';",
+			r.now().Add(-staleLock).UTC().Format(timeLayout)))
+
+		err := r.exec.Exec(fmt.Sprintf("INSERT INTO schema_migrations_lock (id, owner, locked_at) VALUES (1, '%s', '%s');",
+			r.owner, r.now().UTC().Format(timeLayout)))
+		if err == nil {
+			return nil
+		}
+		if !r.now().Before(deadline) {
+			return fmt.Errorf("%w: %v", ErrLocked, err)
+		}
+		r.sleep(time.Second)
+	}
+}
+
+func (r *Runner) unlock() {
+	if err := r.exec.Exec(fmt.Sprintf("DELETE FROM schema_migrations_lock WHERE owner = '%s';", r.owner)); err != nil {
+		fmt.Fprintf(r.out, "failed to release the migration lock: %v\n", err)
+	}
+}
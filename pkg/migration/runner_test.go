@@ -0,0 +1,416 @@
+package migration
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/models"
+)
+
+type sqliteExecutor struct {
+	db *sql.DB
+}
+
+func (e *sqliteExecutor) Exec(query string) error {
+	_, err := e.db.Exec(query)
+	return err
+}
+
+var testFiles = fstest.MapFS{
+	"sql/0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY);")},
+	"sql/0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	"sql/0002_create_links.up.sql":   {Data: []byte("CREATE TABLE links (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users(id));")},
+	"sql/0002_create_links.down.sql": {Data: []byte("DROP TABLE links;")},
+	"sql/0003_add_title.up.sql":      {Data: []byte("ALTER TABLE links ADD COLUMN title TEXT;")},
+	"sql/0003_add_title.down.sql":    {Data: []byte("ALTER TABLE links DROP COLUMN title;")},
+}
+
+func newTestRunner(t *testing.T, dir string) (*Runner, *sqliteExecutor, *bytes.Buffer) {
+	t.Helper()
+	path := filepath.Join(dir, "migrations.db")
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	client, err := database.NewSqliteClient(path)
+	if err != nil {
+		t.Fatalf("failed to open sqlite client: %v", err)
+	}
+
+	migrations, err := Load(testFiles, "sql")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	exec := &sqliteExecutor{db: db}
+	runner := NewRunner(exec, client, migrations, out)
+	runner.sleep = func(time.Duration) {}
+	return runner, exec, out
+}
+
+func states(t *testing.T, r *Runner) string {
+	t.Helper()
+	statuses, err := r.Status()
+	if err != nil {
+		t.Fatalf("failed to read status: %v", err)
+	}
+	result := []string{}
+	for _, s := range statuses {
+		result = append(result, s.State)
+	}
+	return strings.Join(result, ",")
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Embedded()
+	if err != nil {
+		t.Fatalf("failed to load embedded migrations: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 || m.Up == "" || m.Down == "" {
+			t.Errorf("unexpected migration %d: %04d_%s", i, m.Version, m.Name)
+		}
+	}
+	if migrations[0].Name != "create_users_info" {
+		t.Errorf("expected users_info to be created first, got %s", migrations[0].Name)
+	}
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{name: "bad file name", files: fstest.MapFS{"sql/create_users.sql": {Data: []byte("SELECT 1;")}}},
+		{name: "version used twice", files: fstest.MapFS{
+			"sql/0001_a.up.sql": {Data: []byte("SELECT 1;")},
+			"sql/0001_b.up.sql": {Data: []byte("SELECT 1;")},
+		}},
+		{name: "down without up", files: fstest.MapFS{"sql/0001_a.down.sql": {Data: []byte("SELECT 1;")}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.files, "sql"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+
+	files, err := Create(dir, "Add link-title")
+	if err != nil {
+		t.Fatalf("failed to create migration: %v", err)
+	}
+	if filepath.Base(files[0]) != "0001_add_link_title.up.sql" || filepath.Base(files[1]) != "0001_add_link_title.down.sql" {
+		t.Errorf("unexpected files %v", files)
+	}
+
+	files, err = Create(dir, "next")
+	if err != nil || filepath.Base(files[0]) != "0002_next.up.sql" {
+		t.Errorf("expected the next version, got %v (%v)", files, err)
+	}
+
+	if _, err := Create(dir, "drop;table"); err == nil {
+		t.Error("expected an error for an invalid name")
+	}
+}
+
+func TestRunner_UpDown(t *testing.T) {
+	runner, _, _ := newTestRunner(t, t.TempDir())
+
+	applied, err := runner.Up(2)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("expected 2 migrations up to version 2, got %d (%v)", len(applied), err)
+	}
+	if got := states(t, runner); got != "applied,applied,pending" {
+		t.Errorf("unexpected states %s", got)
+	}
+
+	applied, err = runner.Up(0)
+	if err != nil || len(applied) != 1 || applied[0].Version != 3 {
+		t.Fatalf("expected migration 3, got %v (%v)", applied, err)
+	}
+
+	applied, err = runner.Up(0)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("expected nothing to apply, got %v (%v)", applied, err)
+	}
+
+	reverted, err := runner.Down(2)
+	if err != nil || len(reverted) != 2 || reverted[0].Version != 3 || reverted[1].Version != 2 {
+		t.Fatalf("expected migrations 3 and 2 reverted, got %v (%v)", reverted, err)
+	}
+	if got := states(t, runner); got != "applied,pending,pending" {
+		t.Errorf("unexpected states %s", got)
+	}
+
+	if _, err := runner.Up(0); err != nil {
+		t.Fatalf("failed to apply again: %v", err)
+	}
+	if got := states(t, runner); got != "applied,applied,applied" {
+		t.Errorf("unexpected states %s", got)
+	}
+}
+
+// readOnly fails every statement, as a database role without DDL rights.
+type readOnly struct{}
+
+func (readOnly) Exec(query string) error {
+	return errors.New("permission denied")
+}
+
+func TestRunner_StatusReadOnly(t *testing.T) {
+	runner, _, _ := newTestRunner(t, t.TempDir())
+	runner.exec = readOnly{}
+
+	if got := states(t, runner); got != "pending,pending,pending" {
+		t.Errorf("expected a fresh database to have every migration pending, got %s", got)
+	}
+}
+
+// postgresOnly strips the Postgres syntax SQLite lacks, so the embedded
+// migrations can run in tests.
+var postgresOnly = strings.NewReplacer(
+	" DEFAULT gen_random_uuid()", "",
+	" DEFAULT now()", "",
+	"ADD COLUMN IF NOT EXISTS", "ADD COLUMN",
+)
+
+// sqliteMigrations returns the embedded migrations translated for SQLite.
+func sqliteMigrations(t *testing.T) []Migration {
+	t.Helper()
+	migrations, err := Embedded()
+	if err != nil {
+		t.Fatalf("failed to load embedded migrations: %v", err)
+	}
+	for i := range migrations {
+		migrations[i].Up = postgresOnly.Replace(migrations[i].Up)
+		if strings.Contains(migrations[i].Up, "CREATE OR REPLACE FUNCTION") {
+			// SQLite has no stored functions
+			migrations[i].Up = "SELECT 1;"
+		}
+	}
+	return migrations
+}
+
+// baseline is the schema deployments had before migrations were versioned.
+const baseline = `
+CREATE TABLE users_info (uuid uuid PRIMARY KEY, "Nick_Name" TEXT NOT NULL, "Telegram_id" BIGINT UNIQUE NOT NULL, created_at TIMESTAMP);
+CREATE TABLE urls (uuid uuid PRIMARY KEY, user_uuid uuid NOT NULL REFERENCES users_info(uuid) ON DELETE CASCADE, "Telegram_id" BIGINT NOT NULL, "Hash" TEXT NOT NULL, "Url" TEXT NOT NULL, created_at TIMESTAMP);
+CREATE TABLE log_action (uuid uuid PRIMARY KEY, user_uuid uuid NOT NULL REFERENCES users_info(uuid) ON DELETE CASCADE, "Telegram_id" BIGINT NOT NULL, "Action" TEXT NOT NULL, created_at TIMESTAMP);
+CREATE TABLE log_error (uuid uuid PRIMARY KEY, user_uuid uuid NOT NULL REFERENCES users_info(uuid) ON DELETE CASCADE, "Telegram_id" BIGINT NOT NULL, "Error" TEXT NOT NULL, "Error_code" TEXT NOT NULL, created_at TIMESTAMP);
+INSERT INTO users_info (uuid, "Nick_Name", "Telegram_id") VALUES ('u1', 'alice', 1);
+INSERT INTO urls (uuid, user_uuid, "Telegram_id", "Hash", "Url", created_at) VALUES ('l0', 'u1', 1, 'abc', 'https://older.com', '2025-01-01 10:00:00');
+INSERT INTO urls (uuid, user_uuid, "Telegram_id", "Hash", "Url", created_at) VALUES ('l1', 'u1', 1, 'abc', 'https://valid.com', '2025-01-02 10:00:00');
+INSERT INTO urls (uuid, user_uuid, "Telegram_id", "Hash", "Url") VALUES ('l2', 'u1', 1, 'xyz', 'https://first.com');
+INSERT INTO urls (uuid, user_uuid, "Telegram_id", "Hash", "Url") VALUES ('l3', 'u1', 1, 'xyz', 'https://second.com');
+`
+
+func TestRunner_FromBaseline(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite", filepath.Join(dir, "migrations.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	if _, err := db.Exec(baseline); err != nil {
+		t.Fatalf("failed to create the baseline schema: %v", err)
+	}
+	db.Close()
+	runner, exec, _ := newTestRunner(t, dir)
+
+	runner.migrations = sqliteMigrations(t)
+
+	if _, err := runner.Up(0); err != nil {
+		t.Fatalf("failed to migrate the baseline schema: %v", err)
+	}
+
+	var disabled bool
+	err = exec.db.QueryRow(`SELECT "Disabled" FROM urls WHERE "Hash" = 'abc' AND "Expires_at" IS NULL`).Scan(&disabled)
+	if err != nil || disabled {
+		t.Errorf("expected the existing link to get the new columns, got disabled=%v (%v)", disabled, err)
+	}
+
+	// duplicate codes of the baseline keep their newest link
+	for hash, want := range map[string]string{"abc": "https://valid.com", "xyz": "https://second.com"} {
+		var count int
+		var url string
+		err = exec.db.QueryRow(`SELECT count(*), max("Url") FROM urls WHERE "Hash" = ?`, hash).Scan(&count, &url)
+		if err != nil || count != 1 || url != want {
+			t.Errorf("expected %s to keep only %s, got %d rows with %s (%v)", hash, want, count, url, err)
+		}
+	}
+	if err := exec.Exec(`INSERT INTO urls (uuid, user_uuid, "Telegram_id", "Hash", "Url") VALUES ('l9', 'u1', 1, 'abc', 'https://other.com');`); err == nil {
+		t.Error("expected codes to be unique after migrating")
+	}
+}
+
+// sqliteTypes maps the Postgres column types to the ones models.SqliteRequests
+// uses for them.
+var sqliteTypes = map[string]string{
+	"UUID":        "TEXT",
+	"TIMESTAMP":   "TEXT",
+	"TIMESTAMPTZ": "TEXT",
+	"BIGINT":      "INTEGER",
+}
+
+// columns lists the columns of every table of db with their types. NOT NULL
+// is part of the type, except on user_uuid, which SqliteRequests does not
+// enforce.
+func columns(t *testing.T, db *sql.DB) map[string]map[string]string {
+	t.Helper()
+	tables := map[string]map[string]string{}
+	for _, table := range models.Tables {
+		rows, err := db.Query(`SELECT name, type, "notnull" FROM pragma_table_info(?)`, table)
+		if err != nil {
+			t.Fatalf("failed to read table %s: %v", table, err)
+		}
+		tables[table] = map[string]string{}
+		for rows.Next() {
+			var name, kind string
+			var notNull bool
+			if err := rows.Scan(&name, &kind, &notNull); err != nil {
+				t.Fatalf("failed to read table %s: %v", table, err)
+			}
+			kind = strings.ToUpper(kind)
+			if mapped, ok := sqliteTypes[kind]; ok {
+				kind = mapped
+			}
+			if notNull && name != "user_uuid" {
+				kind += " NOT NULL"
+			}
+			tables[table][name] = kind
+		}
+		rows.Close()
+	}
+	return tables
+}
+
+func TestSqliteRequests_MatchMigrations(t *testing.T) {
+	dir := t.TempDir()
+
+	migrated, err := sql.Open("sqlite", filepath.Join(dir, "migrated.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	defer migrated.Close()
+	for _, m := range sqliteMigrations(t) {
+		if _, err := migrated.Exec(m.Up); err != nil {
+			t.Fatalf("failed to apply %04d_%s: %v", m.Version, m.Name, err)
+		}
+	}
+
+	mirrored, err := sql.Open("sqlite", filepath.Join(dir, "mirrored.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	defer mirrored.Close()
+	if len(models.SqliteRequests) != len(models.Tables) {
+		t.Errorf("expected a request for each of %d tables, got %d", len(models.Tables), len(models.SqliteRequests))
+	}
+	for _, table := range models.Tables {
+		if _, err := mirrored.Exec(models.SqliteRequests[table]); err != nil {
+			t.Fatalf("failed to create table %s: %v", table, err)
+		}
+	}
+
+	want, got := columns(t, migrated), columns(t, mirrored)
+	for _, table := range models.Tables {
+		if len(want[table]) == 0 {
+			t.Errorf("table %s is not created by any migration", table)
+		}
+		for name, kind := range want[table] {
+			if got[table][name] != kind {
+				t.Errorf("%s.%s: migrations have %s, SqliteRequests %q", table, name, kind, got[table][name])
+			}
+		}
+		for name := range got[table] {
+			if _, ok := want[table][name]; !ok {
+				t.Errorf("%s.%s is not in the migrations", table, name)
+			}
+		}
+	}
+}
+
+func TestRunner_ChecksumMismatch(t *testing.T) {
+	runner, _, _ := newTestRunner(t, t.TempDir())
+	if _, err := runner.Up(0); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	runner.migrations[1].Up = "CREATE TABLE links (id INTEGER PRIMARY KEY, url TEXT);"
+	runner.migrations = append(runner.migrations, Migration{Version: 4, Name: "next", Up: "SELECT 1;"})
+
+	if _, err := runner.Up(0); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if got := states(t, runner); got != "applied,modified,applied,pending" {
+		t.Errorf("unexpected states %s", got)
+	}
+}
+
+func TestRunner_DryRun(t *testing.T) {
+	runner, _, out := newTestRunner(t, t.TempDir())
+	runner.DryRun = true
+
+	applied, err := runner.Up(0)
+	if err != nil || len(applied) != 3 {
+		t.Fatalf("expected 3 planned migrations, got %d (%v)", len(applied), err)
+	}
+	if !strings.Contains(out.String(), "-- up 0001_create_users\nCREATE TABLE users") {
+		t.Errorf("expected the planned SQL, got:\n%s", out.String())
+	}
+
+	runner.DryRun = false
+	if got := states(t, runner); got != "pending,pending,pending" {
+		t.Errorf("dry run changed the database: %s", got)
+	}
+}
+
+func TestRunner_Lock(t *testing.T) {
+	tests := []struct {
+		name      string
+		lockedAt  time.Duration
+		expectErr error
+	}{
+		{name: "held by another run", lockedAt: -time.Minute, expectErr: ErrLocked},
+		{name: "stale lock is taken over", lockedAt: -time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, exec, _ := newTestRunner(t, t.TempDir())
+			runner.LockWait = 0
+
+			if err := exec.Exec(bootstrap); err != nil {
+				t.Fatalf("failed to bootstrap: %v", err)
+			}
+			lockedAt := time.Now().Add(tt.lockedAt).UTC().Format(timeLayout)
+			if err := exec.Exec("INSERT INTO schema_migrations_lock (id, owner, locked_at) VALUES (1, 'other', '" + lockedAt + "');"); err != nil {
+				t.Fatalf("failed to seed lock: %v", err)
+			}
+
+			_, err := runner.Up(0)
+			if !errors.Is(err, tt.expectErr) {
+				t.Errorf("expected error %v, got %v", tt.expectErr, err)
+			}
+
+			var locks int
+			exec.db.QueryRow("SELECT count(*) FROM schema_migrations_lock WHERE owner = ?", runner.owner).Scan(&locks)
+			if locks != 0 {
+				t.Error("expected the lock to be released")
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS users_info (
+    uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    "Nick_Name" TEXT NOT NULL,
+    "Telegram_id" BIGINT UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
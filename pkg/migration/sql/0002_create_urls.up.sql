@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS urls (
+    uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_uuid uuid NOT NULL REFERENCES users_info(uuid) ON DELETE CASCADE,
+    "Telegram_id" BIGINT NOT NULL,
+    "Hash" TEXT NOT NULL,
+    "Url" TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
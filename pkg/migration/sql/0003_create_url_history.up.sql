@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS url_history (
+    uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    "Telegram_id" BIGINT NOT NULL,
+    "Hash" TEXT NOT NULL,
+    "Old_url" TEXT NOT NULL,
+    "New_url" TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS url_history_hash_idx ON url_history ("Hash", created_at);
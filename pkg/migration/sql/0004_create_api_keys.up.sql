@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    "Telegram_id" BIGINT NOT NULL,
+    "Key_hash" TEXT UNIQUE NOT NULL,
+    "Prefix" TEXT NOT NULL,
+    "Revoked" BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS api_keys_telegram_id_idx ON api_keys ("Telegram_id");
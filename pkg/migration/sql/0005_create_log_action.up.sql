@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS log_action (
+    uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_uuid uuid NOT NULL REFERENCES users_info(uuid) ON DELETE CASCADE,
+    "Telegram_id" BIGINT NOT NULL,
+    "Action" TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
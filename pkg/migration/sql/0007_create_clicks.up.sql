@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS clicks (
+    uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    "Hash" TEXT NOT NULL,
+    "Referrer" TEXT NOT NULL DEFAULT '',
+    "User_agent" TEXT NOT NULL DEFAULT '',
+    "Ip_hash" TEXT NOT NULL DEFAULT '',
+    "Country" TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS clicks_hash_created_at_idx ON clicks ("Hash", created_at);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS rate_limit_hits (
+    uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    "Key" TEXT NOT NULL,
+    "Expires_at" TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS rate_limit_hits_key_created_at_idx ON rate_limit_hits ("Key", created_at);
+CREATE INDEX IF NOT EXISTS rate_limit_hits_expires_at_idx ON rate_limit_hits ("Expires_at");
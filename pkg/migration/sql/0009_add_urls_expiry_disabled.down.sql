@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS urls_hash_key;
+ALTER TABLE urls DROP COLUMN IF EXISTS "Disabled";
+ALTER TABLE urls DROP COLUMN IF EXISTS "Expires_at";
@@ -0,0 +1,11 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS "Expires_at" TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS "Disabled" BOOLEAN NOT NULL DEFAULT false;
+-- the baseline did not enforce unique codes: keep the newest link per code
+DELETE FROM urls
+WHERE EXISTS (
+    SELECT 1 FROM urls newer
+    WHERE newer."Hash" = urls."Hash"
+      AND (coalesce(newer.created_at, '-infinity') > coalesce(urls.created_at, '-infinity')
+        OR (coalesce(newer.created_at, '-infinity') = coalesce(urls.created_at, '-infinity') AND newer.uuid > urls.uuid))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS urls_hash_key ON urls ("Hash");
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS take_rate_limit_hit(TEXT, INTEGER, DOUBLE PRECISION, TIMESTAMPTZ);
@@ -0,0 +1,23 @@
+-- counts and records a hit of hit_key in one call, so concurrent requests
+-- cannot overshoot max_hits within the window
+CREATE OR REPLACE FUNCTION take_rate_limit_hit(hit_key TEXT, max_hits INTEGER, window_seconds DOUBLE PRECISION, at TIMESTAMPTZ)
+RETURNS TABLE (allowed BOOLEAN, hits INTEGER, oldest TIMESTAMPTZ)
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    -- requests of one key wait for each other until the transaction ends
+    PERFORM pg_advisory_xact_lock(hashtext(hit_key));
+
+    SELECT count(*), min(h.created_at) INTO hits, oldest
+    FROM rate_limit_hits h
+    WHERE h."Key" = hit_key AND h.created_at > at - make_interval(secs => window_seconds);
+
+    allowed := hits < max_hits;
+    IF allowed THEN
+        INSERT INTO rate_limit_hits ("Key", "Expires_at", created_at)
+        VALUES (hit_key, at + make_interval(secs => window_seconds), at);
+    END IF;
+    RETURN NEXT;
+END;
+$$;
+GRANT EXECUTE ON FUNCTION take_rate_limit_hit(TEXT, INTEGER, DOUBLE PRECISION, TIMESTAMPTZ) TO service_role;
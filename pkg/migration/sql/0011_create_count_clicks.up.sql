@@ -0,0 +1,11 @@
+-- counts the clicks of several links in one call
+CREATE OR REPLACE FUNCTION count_clicks(hashes TEXT[])
+RETURNS TABLE (hash TEXT, clicks INTEGER)
+LANGUAGE sql STABLE
+AS $$
+    SELECT c."Hash", count(*)::INTEGER
+    FROM clicks c
+    WHERE c."Hash" = ANY(hashes)
+    GROUP BY c."Hash";
+$$;
+GRANT EXECUTE ON FUNCTION count_clicks(TEXT[]) TO service_role;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS link_creations (
+    uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+    "Telegram_id" BIGINT NOT NULL,
+    "Hash" TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS link_creations_telegram_id_created_at_idx ON link_creations ("Telegram_id", created_at);
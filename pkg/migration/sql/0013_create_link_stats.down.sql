@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS link_stats(TEXT, TIMESTAMPTZ, INTEGER);
@@ -0,0 +1,44 @@
+-- aggregates the clicks of one link since a day, so a report reads a single
+-- row instead of every click
+CREATE OR REPLACE FUNCTION link_stats(link_hash TEXT, since TIMESTAMPTZ, top_n INTEGER)
+RETURNS JSON
+LANGUAGE sql STABLE
+AS $$
+    WITH window_clicks AS (
+        SELECT c.created_at, c."Ip_hash", c."Country",
+            CASE WHEN c."Referrer" = '' THEN 'direct'
+                ELSE coalesce(substring(c."Referrer" from '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/?#]*@)?([^/?#]+)'), c."Referrer")
+            END AS referrer
+        FROM clicks c
+        WHERE c."Hash" = link_hash AND c.created_at >= since
+    )
+    SELECT json_build_object(
+        'total_clicks', (SELECT count(*) FROM window_clicks),
+        'unique_visitors', (SELECT count(DISTINCT "Ip_hash") FROM window_clicks WHERE "Ip_hash" <> ''),
+        'last_click', (SELECT max(c.created_at) FROM clicks c WHERE c."Hash" = link_hash),
+        'per_day', (
+            SELECT coalesce(json_agg(json_build_object('day', d.day, 'clicks', d.clicks) ORDER BY d.day), '[]'::json)
+            FROM (
+                SELECT to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, count(*) AS clicks
+                FROM window_clicks GROUP BY 1
+            ) d
+        ),
+        'referrers', (
+            SELECT coalesce(json_agg(json_build_object('referrer', r.referrer, 'clicks', r.clicks) ORDER BY r.clicks DESC, r.referrer), '[]'::json)
+            FROM (
+                SELECT referrer, count(*) AS clicks
+                FROM window_clicks GROUP BY referrer
+                ORDER BY clicks DESC, referrer LIMIT top_n
+            ) r
+        ),
+        'countries', (
+            SELECT coalesce(json_agg(json_build_object('country', k.country, 'clicks', k.clicks) ORDER BY k.clicks DESC, k.country), '[]'::json)
+            FROM (
+                SELECT "Country" AS country, count(*) AS clicks
+                FROM window_clicks WHERE "Country" <> '' GROUP BY "Country"
+                ORDER BY clicks DESC, country LIMIT top_n
+            ) k
+        )
+    );
+$$;
+GRANT EXECUTE ON FUNCTION link_stats(TEXT, TIMESTAMPTZ, INTEGER) TO service_role;
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS take_link_quota(BIGINT, TEXT, INTEGER, INTEGER, TIMESTAMPTZ);
@@ -0,0 +1,45 @@
+-- counts and records a link creation of creator in one call, so concurrent
+-- requests cannot overshoot the link quota; a limit of zero or less is not
+-- enforced
+CREATE OR REPLACE FUNCTION take_link_quota(creator BIGINT, link_hash TEXT, per_minute INTEGER, per_day INTEGER, at TIMESTAMPTZ)
+RETURNS TABLE (allowed BOOLEAN, exceeded TEXT, creation uuid)
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    created INTEGER;
+BEGIN
+    -- creations of one user wait for each other until the transaction ends
+    PERFORM pg_advisory_xact_lock(hashtext('link_creations'), hashtext(creator::TEXT));
+
+    IF per_minute > 0 THEN
+        SELECT count(*) INTO created
+        FROM link_creations c
+        WHERE c."Telegram_id" = creator AND c.created_at >= at - interval '1 minute';
+        IF created >= per_minute THEN
+            allowed := false;
+            exceeded := 'minute';
+            RETURN NEXT;
+            RETURN;
+        END IF;
+    END IF;
+
+    IF per_day > 0 THEN
+        SELECT count(*) INTO created
+        FROM link_creations c
+        WHERE c."Telegram_id" = creator AND c.created_at >= at - interval '24 hours';
+        IF created >= per_day THEN
+            allowed := false;
+            exceeded := 'day';
+            RETURN NEXT;
+            RETURN;
+        END IF;
+    END IF;
+
+    INSERT INTO link_creations ("Telegram_id", "Hash", created_at)
+    VALUES (creator, link_hash, at)
+    RETURNING uuid INTO creation;
+    allowed := true;
+    RETURN NEXT;
+END;
+$$;
+GRANT EXECUTE ON FUNCTION take_link_quota(BIGINT, TEXT, INTEGER, INTEGER, TIMESTAMPTZ) TO service_role;
@@ -1,9 +1,15 @@
 package models
 
-import tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+import (
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
 
 type RequestData struct {
-	Url string `json:"url"`
+	Url      string `json:"url"`
+	Alias    string `json:"alias,omitempty"`
+	LifeTime string `json:"life_time,omitempty"`
 }
 
 type Respons struct {
@@ -11,70 +17,213 @@ type Respons struct {
 }
 
 type Url struct {
+	User_uuid   string     `json:"user_uuid,omitempty"`
+	Telegram_id int64      `json:"Telegram_id"`
+	Hash        string     `json:"Hash"`
+	Url         string     `json:"Url"`
+	Expires_at  *time.Time `json:"Expires_at,omitempty"`
+	Disabled    bool       `json:"Disabled,omitempty"`
+}
+
+// IsExpired reports whether the link has an expiration time that is not after now.
+func (u Url) IsExpired(now time.Time) bool {
+	return u.Expires_at != nil && !now.Before(*u.Expires_at)
+}
+
+// UrlHistory records a change of the destination of a short link.
+type UrlHistory struct {
 	Telegram_id int64  `json:"Telegram_id"`
 	Hash        string `json:"Hash"`
-	Url         string `json:"Url"`
+	Old_url     string `json:"Old_url"`
+	New_url     string `json:"New_url"`
+}
+
+// LinkCreation records that a Telegram user created a short link. Rows stay
+// when the link is deleted, so the link quota counts them.
+type LinkCreation struct {
+	Telegram_id int64  `json:"Telegram_id"`
+	Hash        string `json:"Hash"`
+}
+
+// ApiKey is a hashed API key of a Telegram user. Prefix is the visible
+// start of the key so the owner can recognize it.
+type ApiKey struct {
+	Telegram_id int64  `json:"Telegram_id"`
+	Key_hash    string `json:"Key_hash"`
+	Prefix      string `json:"Prefix"`
+	Revoked     bool   `json:"Revoked,omitempty"`
 }
 
 type LogAction struct {
+	User_uuid   string `json:"user_uuid,omitempty"`
 	Telegram_id int64  `json:"Telegram_id"`
 	Action      string `json:"Action"`
 }
 
 type LogError struct {
+	User_uuid   string `json:"user_uuid,omitempty"`
 	Telegram_id int64  `json:"Telegram_id"`
 	Error       string `json:"Error"`
 	Error_code  string `json:"Error_code"`
 }
 
+type Click struct {
+	Hash       string    `json:"Hash"`
+	Referrer   string    `json:"Referrer"`
+	User_agent string    `json:"User_agent"`
+	Ip_hash    string    `json:"Ip_hash"`
+	Country    string    `json:"Country"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// RateLimitHit is one allowed request in the shared rate limiter.
+type RateLimitHit struct {
+	Key        string    `json:"Key"`
+	Created_at time.Time `json:"created_at"`
+	Expires_at time.Time `json:"Expires_at"`
+}
+
+type DayClicks struct {
+	Day    string `json:"day"`
+	Clicks int    `json:"clicks"`
+}
+
+type ReferrerClicks struct {
+	Referrer string `json:"referrer"`
+	Clicks   int    `json:"clicks"`
+}
+
+type CountryClicks struct {
+	Country string `json:"country"`
+	Clicks  int    `json:"clicks"`
+}
+
+type LinkStats struct {
+	Hash           string           `json:"hash"`
+	TotalClicks    int              `json:"total_clicks"`
+	UniqueVisitors int              `json:"unique_visitors"`
+	LastClick      *time.Time       `json:"last_click,omitempty"`
+	PerDay         []DayClicks      `json:"per_day"`
+	Referrers      []ReferrerClicks `json:"referrers"`
+	Countries      []CountryClicks  `json:"countries"`
+}
+
 type Users struct {
+	Uuid        string `json:"uuid,omitempty"`
 	Telegram_id int64
 	Nick_Name   string
 }
 
 type TelegramBot interface {
 	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
 	GetUpdatesChan(tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel
+	StopReceivingUpdates()
 }
 
-var SqlRequests = map[string]string{
+// Tables lists the tables of the service in the order they depend on each
+// other.
+var Tables = []string{"users_info", "urls", "url_history", "api_keys", "log_action", "log_error", "clicks", "rate_limit_hits", "link_creations"}
+
+// SqliteRequests mirrors the migrations in pkg/migration/sql for the embedded
+// database backend; TestSqliteRequests_MatchMigrations keeps them in step.
+// Timestamps are stored as RFC 3339 text and user_uuid is not enforced,
+// since SQLite has no uuid type and foreign keys are off by default.
+var SqliteRequests = map[string]string{
 	"users_info": `
 	CREATE TABLE IF NOT EXISTS users_info (
-		uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+		uuid TEXT PRIMARY KEY,
 		"Nick_Name" TEXT NOT NULL,
-		"Telegram_id" BIGINT UNIQUE NOT NULL,
-		created_at TIMESTAMP DEFAULT now()
+		"Telegram_id" INTEGER UNIQUE NOT NULL,
+		created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
 	);
 	`,
 	"urls": `
 		CREATE TABLE IF NOT EXISTS urls (
-			uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
-			user_uuid uuid NOT NULL REFERENCES users_info(uuid) ON DELETE CASCADE,
-			"Telegram_id" BIGINT NOT NULL,
-			"Hash" TEXT NOT NULL,
+			uuid TEXT PRIMARY KEY,
+			user_uuid TEXT REFERENCES users_info(uuid) ON DELETE CASCADE,
+			"Telegram_id" INTEGER NOT NULL,
+			"Hash" TEXT UNIQUE NOT NULL,
 			"Url" TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT now()
+			"Expires_at" TEXT,
+			"Disabled" BOOLEAN NOT NULL DEFAULT 0,
+			created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+		);
+	`,
+	"url_history": `
+		CREATE TABLE IF NOT EXISTS url_history (
+			uuid TEXT PRIMARY KEY,
+			"Telegram_id" INTEGER NOT NULL,
+			"Hash" TEXT NOT NULL,
+			"Old_url" TEXT NOT NULL,
+			"New_url" TEXT NOT NULL,
+			created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+		);
+		CREATE INDEX IF NOT EXISTS url_history_hash_idx ON url_history ("Hash", created_at);
+	`,
+	"api_keys": `
+		CREATE TABLE IF NOT EXISTS api_keys (
+			uuid TEXT PRIMARY KEY,
+			"Telegram_id" INTEGER NOT NULL,
+			"Key_hash" TEXT UNIQUE NOT NULL,
+			"Prefix" TEXT NOT NULL,
+			"Revoked" BOOLEAN NOT NULL DEFAULT 0,
+			created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
 		);
+		CREATE INDEX IF NOT EXISTS api_keys_telegram_id_idx ON api_keys ("Telegram_id");
 	`,
 	"log_action": `
 		CREATE TABLE IF NOT EXISTS log_action (
-			uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
-			user_uuid uuid NOT NULL REFERENCES users_info(uuid) ON DELETE CASCADE,
-			"Telegram_id" BIGINT NOT NULL,
+			uuid TEXT PRIMARY KEY,
+			user_uuid TEXT REFERENCES users_info(uuid) ON DELETE CASCADE,
+			"Telegram_id" INTEGER NOT NULL,
 			"Action" TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT now()
+			created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
 		);
 	`,
 	"log_error": `
 		CREATE TABLE IF NOT EXISTS log_error (
-			uuid uuid DEFAULT gen_random_uuid() PRIMARY KEY,
-			user_uuid uuid NOT NULL REFERENCES users_info(uuid) ON DELETE CASCADE,
-			"Telegram_id" BIGINT NOT NULL,
+			uuid TEXT PRIMARY KEY,
+			user_uuid TEXT REFERENCES users_info(uuid) ON DELETE CASCADE,
+			"Telegram_id" INTEGER NOT NULL,
 			"Error" TEXT NOT NULL,
 			"Error_code" TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT now()
+			created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
 		);
-	`}
+	`,
+	"clicks": `
+		CREATE TABLE IF NOT EXISTS clicks (
+			uuid TEXT PRIMARY KEY,
+			"Hash" TEXT NOT NULL,
+			"Referrer" TEXT NOT NULL DEFAULT '',
+			"User_agent" TEXT NOT NULL DEFAULT '',
+			"Ip_hash" TEXT NOT NULL DEFAULT '',
+			"Country" TEXT NOT NULL DEFAULT '',
+			created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+		);
+		CREATE INDEX IF NOT EXISTS clicks_hash_created_at_idx ON clicks ("Hash", created_at);
+	`,
+	"rate_limit_hits": `
+		CREATE TABLE IF NOT EXISTS rate_limit_hits (
+			uuid TEXT PRIMARY KEY,
+			"Key" TEXT NOT NULL,
+			"Expires_at" TEXT NOT NULL,
+			created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+		);
+		CREATE INDEX IF NOT EXISTS rate_limit_hits_key_created_at_idx ON rate_limit_hits ("Key", created_at);
+		CREATE INDEX IF NOT EXISTS rate_limit_hits_expires_at_idx ON rate_limit_hits ("Expires_at");
+	`,
+	"link_creations": `
+		CREATE TABLE IF NOT EXISTS link_creations (
+			uuid TEXT PRIMARY KEY,
+			"Telegram_id" INTEGER NOT NULL,
+			"Hash" TEXT NOT NULL,
+			created_at TEXT DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+		);
+		CREATE INDEX IF NOT EXISTS link_creations_telegram_id_created_at_idx ON link_creations ("Telegram_id", created_at);
+	`,
+}
 
 type SupabaseResponse []Url
 
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"os"
 
@@ -14,6 +16,53 @@ type ConfigStruct struct {
 	TelegramApiKey string `yaml:"tg_key"`
 	DatabasebUrl   string `yaml:"db_url"`
 	DatabaseApiKey string `yaml:"db_key"`
+	DatabaseDriver string `yaml:"db_driver"`
+	DatabasePath   string `yaml:"db_path"`
+	CodeGenerator  string `yaml:"code_generator"`
+	CodeLength     int    `yaml:"code_length"`
+	CodeAlphabet   string `yaml:"code_alphabet"`
+
+	CodeCaseInsensitive  bool `yaml:"code_case_insensitive"`
+	CodeExcludeAmbiguous bool `yaml:"code_exclude_ambiguous"`
+
+	IpHashSalt string `yaml:"ip_hash_salt"`
+	ServiceKey string `yaml:"service_key"`
+
+	UserLinksPerMinute int `yaml:"user_links_per_minute"`
+	UserLinksPerDay    int `yaml:"user_links_per_day"`
+
+	BotMode       string `yaml:"bot_mode"`
+	WebhookUrl    string `yaml:"webhook_url"`
+	WebhookSecret string `yaml:"webhook_secret"`
+
+	BotWorkers   int `yaml:"bot_workers"`
+	BotQueueSize int `yaml:"bot_queue_size"`
+
+	MetricsToken string `yaml:"metrics_token"`
+
+	RateLimits         map[string]RateLimitConfig `yaml:"rate_limits"`
+	RateLimitAllowlist []string                   `yaml:"rate_limit_allowlist"`
+	RateLimitStore     string                     `yaml:"rate_limit_store"`
+
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	AccessLog      bool     `yaml:"access_log"`
+}
+
+// RateLimitConfig allows Requests per Period, a duration such as "30s", with
+// bursts of Burst requests counted by Key: "ip", "telegram_id" or "api_key".
+type RateLimitConfig struct {
+	Requests int    `yaml:"requests"`
+	Period   string `yaml:"period"`
+	Burst    int    `yaml:"burst"`
+	Key      string `yaml:"key"`
+}
+
+// DefaultRateLimits are the policies of the redirects, of creating links and
+// of the rest of the API.
+var DefaultRateLimits = map[string]RateLimitConfig{
+	"redirect": {Requests: 120, Period: "1m", Burst: 30, Key: "ip"},
+	"create":   {Requests: 2, Period: "30s", Burst: 2, Key: "telegram_id"},
+	"api":      {Requests: 60, Period: "1m", Burst: 20, Key: "api_key"},
 }
 
 func ReadConfig() {
@@ -30,6 +79,74 @@ func ReadConfig() {
 	}
 	Config = yamlConfig
 
+	if Config.DatabaseDriver == "" {
+		Config.DatabaseDriver = "supabase"
+	}
+	if Config.DatabasePath == "" {
+		Config.DatabasePath = "bot.db"
+	}
+	if Config.IpHashSalt == "" {
+		// unique visitors are only counted per run without a configured salt
+		salt := make([]byte, 16)
+		rand.Read(salt)
+		Config.IpHashSalt = hex.EncodeToString(salt)
+	}
+
+	if Config.ServiceKey == "" {
+		// internal callers are only trusted for one run without a configured key
+		key := make([]byte, 32)
+		rand.Read(key)
+		Config.ServiceKey = hex.EncodeToString(key)
+	}
+
+	if Config.BotMode == "" {
+		Config.BotMode = "polling"
+	}
+	if Config.WebhookSecret == "" {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		Config.WebhookSecret = hex.EncodeToString(secret)
+	}
+
+	if Config.BotWorkers <= 0 {
+		Config.BotWorkers = 8
+	}
+	if Config.BotQueueSize <= 0 {
+		Config.BotQueueSize = 64
+	}
+
+	// -1 lifts a quota
+	if Config.UserLinksPerMinute == 0 {
+		Config.UserLinksPerMinute = 10
+	}
+	if Config.UserLinksPerDay == 0 {
+		Config.UserLinksPerDay = 500
+	}
+
+	if Config.RateLimitStore == "" {
+		Config.RateLimitStore = "memory"
+	}
+	if Config.RateLimits == nil {
+		Config.RateLimits = map[string]RateLimitConfig{}
+	}
+	for name, defaults := range DefaultRateLimits {
+		// -1 requests lift a policy
+		limit := Config.RateLimits[name]
+		if limit.Requests == 0 {
+			limit.Requests = defaults.Requests
+		}
+		if limit.Period == "" {
+			limit.Period = defaults.Period
+		}
+		if limit.Burst <= 0 {
+			limit.Burst = defaults.Burst
+		}
+		if limit.Key == "" {
+			limit.Key = defaults.Key
+		}
+		Config.RateLimits[name] = limit
+	}
+
 	switch Config.Port {
 	case "80":
 		Protocol = "http"
@@ -42,3 +159,27 @@ func ReadConfig() {
 		PortForUrl = ":" + Config.Port
 	}
 }
+
+// Summary is the configuration without tokens, keys and salts, safe to show
+// on /version.
+func (c ConfigStruct) Summary() map[string]interface{} {
+	return map[string]interface{}{
+		"host_name":              c.HostName,
+		"port":                   c.Port,
+		"url_life_time":          c.UrlLifeTime,
+		"db_driver":              c.DatabaseDriver,
+		"code_generator":         c.CodeGenerator,
+		"code_length":            c.CodeLength,
+		"code_case_insensitive":  c.CodeCaseInsensitive,
+		"code_exclude_ambiguous": c.CodeExcludeAmbiguous,
+		"user_links_per_minute":  c.UserLinksPerMinute,
+		"user_links_per_day":     c.UserLinksPerDay,
+		"bot_mode":               c.BotMode,
+		"bot_workers":            c.BotWorkers,
+		"bot_queue_size":         c.BotQueueSize,
+		"rate_limits":            c.RateLimits,
+		"rate_limit_store":       c.RateLimitStore,
+		"trusted_proxies":        c.TrustedProxies,
+		"access_log":             c.AccessLog,
+	}
+}
@@ -0,0 +1,45 @@
+package sweeper
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+type SupabaseDeleter interface {
+	Delete(table string, filter string) ([]byte, error)
+}
+
+// Sweeper periodically purges expired links from the urls table.
+type Sweeper struct {
+	db       SupabaseDeleter
+	interval time.Duration
+	now      func() time.Time
+}
+
+func NewSweeper(db SupabaseDeleter, interval time.Duration) *Sweeper {
+	return &Sweeper{db: db, interval: interval, now: time.Now}
+}
+
+func (s *Sweeper) Sweep() error {
+	filter := "Expires_at=lt." + s.now().UTC().Format(time.RFC3339)
+	_, err := s.db.Delete("urls", filter)
+	return err
+}
+
+// Run sweeps every interval until ctx is done.
+func (s *Sweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := s.Sweep(); err != nil {
+				log.Printf("sweep expired urls failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package sweeper
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockDeleter struct {
+	calledTable  string
+	calledFilter string
+	returnErr    error
+}
+
+func (m *mockDeleter) Delete(table string, filter string) ([]byte, error) {
+	m.calledTable = table
+	m.calledFilter = filter
+	return nil, m.returnErr
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 30, 0, 0, time.FixedZone("UTC+3", 3*60*60))
+
+	tests := []struct {
+		name       string
+		returnErr  error
+		wantFilter string
+		expectErr  bool
+	}{
+		{
+			name:       "deletes expired urls",
+			wantFilter: "Expires_at=lt.2025-03-01T09:30:00Z",
+		},
+		{
+			name:       "database error",
+			returnErr:  errors.New("db error"),
+			wantFilter: "Expires_at=lt.2025-03-01T09:30:00Z",
+			expectErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockDeleter{returnErr: tt.returnErr}
+			s := NewSweeper(mock, time.Minute)
+			s.now = func() time.Time { return now }
+
+			err := s.Sweep()
+			if (err != nil) != tt.expectErr {
+				t.Errorf("expected error = %v, got %v", tt.expectErr, err)
+			}
+			if mock.calledTable != "urls" {
+				t.Errorf("expected table urls, got %s", mock.calledTable)
+			}
+			if mock.calledFilter != tt.wantFilter {
+				t.Errorf("expected filter %q, got %q", tt.wantFilter, mock.calledFilter)
+			}
+		})
+	}
+}
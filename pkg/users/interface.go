@@ -0,0 +1,7 @@
+package users
+
+// IdentityResolver maps Telegram IDs to users_info uuids.
+type IdentityResolver interface {
+	Resolve(telegramID int64) (string, error)
+	Register(telegramID int64, nickName string) (string, error)
+}
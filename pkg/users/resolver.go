@@ -0,0 +1,96 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+	"url-shorter-bot/pkg/cache"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/models"
+)
+
+// cacheTTL bounds how long a deleted user row can be referenced.
+const cacheTTL = time.Hour
+
+// Resolver maps Telegram IDs to the uuid of their users_info row, which
+// urls, log_action and log_error reference.
+type Resolver struct {
+	db    database.SupabaseClient
+	cache cache.Cache
+}
+
+func NewResolver(db database.SupabaseClient, c cache.Cache) *Resolver {
+	return &Resolver{db: db, cache: c}
+}
+
+// Resolve returns the uuid of telegramID, creating the user row without a
+// nick name when the user never sent /start.
+func (r *Resolver) Resolve(telegramID int64) (string, error) {
+	if uuid, ok := r.cache.Get(cacheKey(telegramID)); ok {
+		return uuid.(string), nil
+	}
+	return r.Register(telegramID, "")
+}
+
+// Register returns the uuid of telegramID like Resolve and stores nickName
+// on a row that has none yet.
+func (r *Resolver) Register(telegramID int64, nickName string) (string, error) {
+	user, err := r.get(telegramID)
+	if errors.Is(err, database.ErrNotFound) {
+		user, err = r.create(telegramID, nickName)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if user.Nick_Name == "" && nickName != "" {
+		filter := "Telegram_id=eq." + strconv.FormatInt(telegramID, 10)
+		if _, err := r.db.Update("users_info", filter, map[string]string{"Nick_Name": nickName}); err != nil {
+			return "", err
+		}
+	}
+
+	r.cache.Set(cacheKey(telegramID), user.Uuid, cacheTTL)
+	return user.Uuid, nil
+}
+
+func (r *Resolver) get(telegramID int64) (models.Users, error) {
+	body, err := r.db.Get("users_info", map[string]string{
+		"Telegram_id": strconv.FormatInt(telegramID, 10),
+	})
+	if err != nil {
+		return models.Users{}, err
+	}
+
+	var user models.Users
+	if err := json.Unmarshal(body, &user); err != nil {
+		return models.Users{}, err
+	}
+	return user, nil
+}
+
+func (r *Resolver) create(telegramID int64, nickName string) (models.Users, error) {
+	body, err := r.db.Insert("users_info", models.Users{Telegram_id: telegramID, Nick_Name: nickName})
+	if err != nil {
+		// another request may have created the row in the meantime
+		if user, getErr := r.get(telegramID); getErr == nil {
+			return user, nil
+		}
+		return models.Users{}, err
+	}
+
+	var created []models.Users
+	if err := json.Unmarshal(body, &created); err != nil {
+		return models.Users{}, err
+	}
+	if len(created) == 0 || created[0].Uuid == "" {
+		return models.Users{}, fmt.Errorf("no uuid returned for user %d", telegramID)
+	}
+	return created[0], nil
+}
+
+func cacheKey(telegramID int64) string {
+	return "user:" + strconv.FormatInt(telegramID, 10)
+}
@@ -0,0 +1,95 @@
+package users
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shorter-bot/pkg/cache"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/models"
+)
+
+func newTestResolver(t *testing.T) (*Resolver, database.SupabaseClient) {
+	t.Helper()
+	db, err := database.NewSqliteClient(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	return NewResolver(db, cache.NewMemoryCache(time.Minute, time.Minute)), db
+}
+
+func getUser(t *testing.T, db database.SupabaseClient, telegramID string) models.Users {
+	t.Helper()
+	body, err := db.Get("users_info", map[string]string{"Telegram_id": telegramID})
+	if err != nil {
+		t.Fatalf("failed to get user %s: %v", telegramID, err)
+	}
+	var user models.Users
+	if err := json.Unmarshal(body, &user); err != nil {
+		t.Fatalf("failed to decode user: %v", err)
+	}
+	return user
+}
+
+func TestResolver(t *testing.T) {
+	tests := []struct {
+		name         string
+		existing     *models.Users
+		register     string
+		expectedNick string
+	}{
+		{name: "user without /start is created", expectedNick: ""},
+		{name: "existing user is reused", existing: &models.Users{Telegram_id: 1, Nick_Name: "alice"}, expectedNick: "alice"},
+		{name: "register creates with nick name", register: "alice", expectedNick: "alice"},
+		{name: "register fills a missing nick name", existing: &models.Users{Telegram_id: 1}, register: "alice", expectedNick: "alice"},
+		{name: "register keeps the nick name", existing: &models.Users{Telegram_id: 1, Nick_Name: "alice"}, register: "bob", expectedNick: "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver, db := newTestResolver(t)
+			if tt.existing != nil {
+				if _, err := db.Insert("users_info", *tt.existing); err != nil {
+					t.Fatalf("failed to seed user: %v", err)
+				}
+			}
+
+			var uuid string
+			var err error
+			if tt.register != "" {
+				uuid, err = resolver.Register(1, tt.register)
+			} else {
+				uuid, err = resolver.Resolve(1)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			user := getUser(t, db, "1")
+			if uuid == "" || uuid != user.Uuid {
+				t.Errorf("expected uuid %q, got %q", user.Uuid, uuid)
+			}
+			if user.Nick_Name != tt.expectedNick {
+				t.Errorf("expected nick name %q, got %q", tt.expectedNick, user.Nick_Name)
+			}
+		})
+	}
+}
+
+func TestResolver_Cache(t *testing.T) {
+	resolver, db := newTestResolver(t)
+
+	first, err := resolver.Resolve(1)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if _, err := db.Delete("users_info", "Telegram_id=eq.1"); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+
+	second, err := resolver.Resolve(1)
+	if err != nil || second != first {
+		t.Errorf("expected the cached uuid %q, got %q (%v)", first, second, err)
+	}
+}
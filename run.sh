@@ -2,25 +2,32 @@
 
 set -e
 
-if [ -z "$TG_KEY" ] || [ -z "$DB_URL" ] || [ -z "$DB_KEY" ]; then
-  echo "❌ Error: You must provide TG_KEY, DB_URL and DB_KEY"
+DB_DRIVER=${DB_DRIVER:-supabase}
+
+if [ -z "$TG_KEY" ] || { [ "$DB_DRIVER" = "supabase" ] && { [ -z "$DB_URL" ] || [ -z "$DB_KEY" ]; }; }; then
+  echo "❌ Error: You must provide TG_KEY, DB_URL and DB_KEY (or DB_DRIVER=sqlite)"
   echo "Usage: TG_KEY=... DB_URL=... DB_KEY=... [HOST_NAME=localhost] [PORT=8000] ./run.sh"
   exit 1
 fi
 
 HOST_NAME=${HOST_NAME:-localhost}
 PORT=${PORT:-80} #for http - 80, for https - 443
+URL_LIFE_TIME=${URL_LIFE_TIME:-} #empty - links never expire
 
 cat > config.yaml <<EOF
 host_name: "$HOST_NAME"
 port: "$PORT"
+url_life_time: "$URL_LIFE_TIME"
 tg_key: "$TG_KEY"
 db_url: "$DB_URL"
 db_key: "$DB_KEY"
+db_driver: "$DB_DRIVER"
 EOF
 
 echo "✅ Generated config.yaml"
 
-docker build -t url-shortener-bot -f ./builds/DockerFile .
+docker build -t url-shortener-bot -f ./builds/DockerFile \
+  --build-arg COMMIT="$(git rev-parse --short HEAD 2>/dev/null || echo unknown)" \
+  --build-arg BUILD_TIME="$(date -u +%Y-%m-%dT%H:%M:%SZ)" .
 
 docker run --rm -p "$PORT":"$PORT" url-shortener-bot
\ No newline at end of file
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/migration"
+	"url-shorter-bot/pkg/models"
+)
+
+// Exit codes of the subcommands.
+const (
+	exitOK      = 0
+	exitError   = 1
+	exitUsage   = 2
+	exitPending = 3 // migrate status found pending, changed or missing migrations
+)
+
+const usage = `Usage: bot [command]
+
+Commands:
+  serve                      run the bot and the HTTP server (default)
+  healthcheck                probe /healthz of the running server
+  migrate up [version]       apply pending migrations, up to version if given
+  migrate down [steps]       revert the last steps migrations, 1 by default
+  migrate status             list migrations, exits 3 unless all are applied
+  migrate create <name>      add empty up and down scripts to ` + migration.Dir + `
+
+Flags of migrate:
+  --json                     print the result as JSON
+  --dry-run                  print the SQL of up and down instead of running it
+`
+
+// run dispatches the subcommand in args and returns the exit code.
+func run(args []string) int {
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve()
+		return exitOK
+	case "healthcheck":
+		models.ReadConfig()
+		return healthcheck()
+	case "migrate":
+		return migrateCommand(args, os.Stdout)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		return exitUsage
+	}
+}
+
+// migrateCommand runs "migrate up|down|status|create" and writes the result
+// to stdout.
+func migrateCommand(args []string, stdout io.Writer) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	asJSON := flags.Bool("json", false, "")
+	dryRun := flags.Bool("dry-run", false, "")
+
+	// flags may come before or after the action
+	flagArgs, positional := []string{}, []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			flagArgs = append(flagArgs, arg)
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	if err := flags.Parse(flagArgs); err != nil || len(positional) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsage
+	}
+
+	result := func(code int, value interface{}, text string) int {
+		if *asJSON {
+			json.NewEncoder(stdout).Encode(value)
+		} else {
+			fmt.Fprint(stdout, text)
+		}
+		return code
+	}
+	fail := func(code int, err error) int {
+		return result(code, map[string]string{"error": err.Error()}, "❌ "+err.Error()+"\n")
+	}
+
+	action, params := positional[0], positional[1:]
+
+	if action == "create" {
+		if len(params) != 1 {
+			return fail(exitUsage, errors.New("usage: migrate create <name>"))
+		}
+		files, err := migration.Create(migration.Dir, params[0])
+		if err != nil {
+			return fail(exitError, err)
+		}
+		return result(exitOK, map[string][]string{"created": files}, "✅ Created "+strings.Join(files, ", ")+"\n")
+	}
+
+	number := 0
+	if action == "down" {
+		number = 1
+	}
+	if len(params) > 1 {
+		return fail(exitUsage, fmt.Errorf("too many arguments for migrate %s", action))
+	}
+	if len(params) == 1 {
+		n, err := strconv.Atoi(params[0])
+		if err != nil || n < 1 {
+			return fail(exitUsage, fmt.Errorf("invalid number %q", params[0]))
+		}
+		number = n
+	}
+
+	models.ReadConfig()
+	if models.Config.DatabaseDriver != "supabase" {
+		return fail(exitError, errors.New("migrations run on db_driver supabase, sqlite creates its tables on start"))
+	}
+
+	// progress goes to stderr, so the JSON on stdout stays parseable
+	progress := stdout
+	if *asJSON {
+		progress = os.Stderr
+	}
+	runner, err := newRunner(models.Config.DatabasebUrl, models.Config.DatabaseApiKey, progress)
+	if err != nil {
+		return fail(exitError, err)
+	}
+	runner.DryRun = *dryRun
+
+	switch action {
+	case "up", "down":
+		var changed []migration.Migration
+		if action == "up" {
+			changed, err = runner.Up(number)
+		} else {
+			changed, err = runner.Down(number)
+		}
+		if err != nil {
+			return fail(exitError, err)
+		}
+
+		versions := []map[string]interface{}{}
+		for _, m := range changed {
+			versions = append(versions, map[string]interface{}{"version": m.Version, "name": m.Name})
+		}
+		return result(exitOK, map[string]interface{}{"action": action, "dry_run": *dryRun, "migrations": versions},
+			fmt.Sprintf("✅ migrate %s: %d migrations\n", action, len(changed)))
+
+	case "status":
+		statuses, err := runner.Status()
+		if err != nil {
+			return fail(exitError, err)
+		}
+
+		code := exitOK
+		var text strings.Builder
+		for _, s := range statuses {
+			if s.State != migration.StateApplied {
+				code = exitPending
+			}
+			fmt.Fprintf(&text, "%04d_%-40s %s\n", s.Version, s.Name, s.State)
+		}
+		return result(code, map[string]interface{}{"migrations": statuses, "up_to_date": code == exitOK}, text.String())
+
+	default:
+		return fail(exitUsage, fmt.Errorf("unknown migrate action %q", action))
+	}
+}
+
+// newRunner runs the embedded migrations on the Supabase database.
+func newRunner(databaseUrl, databaseApiKey string, out io.Writer) (*migration.Runner, error) {
+	if databaseUrl == "" || databaseApiKey == "" {
+		return nil, errors.New("db_url or db_key is not set")
+	}
+
+	migrations, err := migration.Embedded()
+	if err != nil {
+		return nil, err
+	}
+	return migration.NewRunner(migration.NewMigrator(databaseUrl, databaseApiKey), database.NewClient(databaseUrl, databaseApiKey), migrations, out), nil
+}
@@ -1,24 +1,48 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
+	"url-shorter-bot/pkg/analytics"
 	"url-shorter-bot/pkg/app/bot"
 	"url-shorter-bot/pkg/app/handlers"
+	"url-shorter-bot/pkg/app/service"
+	"url-shorter-bot/pkg/app/shortcode"
+	"url-shorter-bot/pkg/app/validators"
 	"url-shorter-bot/pkg/cache"
 	"url-shorter-bot/pkg/database"
+	"url-shorter-bot/pkg/health"
+	"url-shorter-bot/pkg/lifecycle"
 	"url-shorter-bot/pkg/logger"
+	"url-shorter-bot/pkg/metrics"
 	"url-shorter-bot/pkg/middleware"
-	"url-shorter-bot/pkg/migration"
 	"url-shorter-bot/pkg/models"
+	"url-shorter-bot/pkg/sweeper"
+	"url-shorter-bot/pkg/users"
 
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/acme/autocert"
 )
 
+// shutdownTimeout bounds the graceful shutdown of every worker together.
+const shutdownTimeout = 15 * time.Second
+
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// serve runs the bot and the HTTP servers until SIGINT or SIGTERM.
+func serve() {
 	//read yaml config
 	models.ReadConfig()
 
@@ -26,8 +50,18 @@ func main() {
 	databaseUrl := models.Config.DatabasebUrl
 	databaseApiKey := models.Config.DatabaseApiKey
 
-	if databaseApiKey == "" || databaseUrl == "" {
-		log.Fatal("❌ db_url or db_key is not set")
+	switch models.Config.DatabaseDriver {
+	case "supabase":
+		if databaseApiKey == "" || databaseUrl == "" {
+			log.Fatal("❌ db_url or db_key is not set")
+		}
+	case "sqlite":
+	default:
+		log.Fatalf("❌ unknown db_driver: %s", models.Config.DatabaseDriver)
+	}
+
+	if _, err := validators.ParseLifeTime(models.Config.UrlLifeTime); err != nil {
+		log.Fatalf("❌ url_life_time is invalid: %v", err)
 	}
 
 	botToken := models.Config.TelegramApiKey
@@ -36,57 +70,192 @@ func main() {
 		log.Fatal("❌ tg_key is not set")
 	}
 
-	//migrations
-	migrator := migration.NewMigrator(databaseUrl, models.Config.DatabaseApiKey)
+	webhookUrl := models.Config.WebhookUrl
+	if webhookUrl == "" {
+		webhookUrl = models.Protocol + "://" + models.Config.HostName + models.PortForUrl
+	}
 
-	for table, request := range models.SqlRequests {
-		ok, err := migrator.TableExists(table)
-		if err != nil {
-			log.Fatalf("failed to check table: %v", err)
+	switch models.Config.BotMode {
+	case "polling":
+	case "webhook":
+		if !strings.HasPrefix(webhookUrl, "https://") {
+			log.Fatal("❌ bot_mode webhook needs HTTPS: use port 443 or set webhook_url")
 		}
+	default:
+		log.Fatalf("❌ unknown bot_mode: %s", models.Config.BotMode)
+	}
 
-		if !ok {
-			fmt.Println("Table " + table + " does not exist. Creating...")
-			if err := migrator.CreateTable(table, request); err != nil {
-				log.Fatalf("failed to create tables: %v", err)
-			}
-			fmt.Println("Table " + table + " created")
-		} else {
-			fmt.Println("Table " + table + " already exists")
+	//migrations
+	if models.Config.DatabaseDriver == "supabase" {
+		if err := migrate(databaseUrl, databaseApiKey); err != nil {
+			log.Fatalf("❌ Failed to migrate the database: %v", err)
 		}
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workers := lifecycle.NewManager()
+
 	//important variablse
 	cache := cache.NewMemoryCache(10*time.Minute, 20*time.Minute)
-	database := database.NewClient(databaseUrl, databaseApiKey)
-	logger := logger.NewDatabaseLogger(database)
+	database := database.Instrument(openDatabase(databaseUrl, databaseApiKey))
+	users := users.NewResolver(database, cache)
+	logger := logger.NewAsyncLogger(logger.NewDatabaseLogger(database, users), 1000)
+	workers.Go("logger", logger.Run)
+
+	reporter := analytics.NewReporter(database)
+	links := service.NewLinkService(database, cache)
+	keys := service.NewApiKeyService(database)
+
+	alphabet := shortcode.Alphabet(models.Config.CodeAlphabet, models.Config.CodeCaseInsensitive, models.Config.CodeExcludeAmbiguous)
+
+	generator, err := shortcode.NewGenerator(models.Config.CodeGenerator, alphabet, models.Config.CodeLength)
+	if err != nil {
+		log.Fatalf("❌ Failed to create code generator: %v", err)
+	}
+
+	shortener := service.NewShortenerService(database, generator, service.Quota{
+		PerMinute: models.Config.UserLinksPerMinute,
+		PerDay:    models.Config.UserLinksPerDay,
+	}, users)
+
+	//click analytics
+	clicks := analytics.NewRecorder(database, 100, 5*time.Second)
+	workers.Go("clicks", clicks.Run)
+
+	//purge expired urls
+	workers.Go("sweeper", sweeper.NewSweeper(database, 10*time.Minute).Run)
+
+	var limiterStore middleware.LimiterStore
+	switch models.Config.RateLimitStore {
+	case "memory":
+		store := middleware.NewMemoryStore(nil)
+		workers.Go("visitors", store.Run)
+		limiterStore = store
+	case "database":
+		// counts are shared by every instance on the same database
+		store := middleware.NewDatabaseStore(database, nil)
+		workers.Go("visitors", store.Run)
+		limiterStore = store
+	default:
+		log.Fatalf("❌ unknown rate_limit_store: %s", models.Config.RateLimitStore)
+	}
 
 	//start bot
 
 	state := bot.NewStateStore()
 
-	handler, err := bot.NewBotHandler(botToken, state, database, logger)
+	handler, err := bot.NewBotHandler(botToken, state, database, logger, reporter, shortener, links, keys, users)
 	if err != nil {
 		log.Fatalf("❌ Failed to create bot: %v", err)
 	}
+	handler.Dispatcher = bot.NewDispatcher(models.Config.BotWorkers, models.Config.BotQueueSize, handler.HandleUpdate)
 
-	go handler.Run()
+	metrics.Default.NewGaugeFunc("url_shorter_bot_queue_length", "Telegram updates waiting for a worker.", func() float64 {
+		return float64(handler.Dispatcher.Stats().Queued)
+	})
+	metrics.Default.NewCounterFunc("url_shorter_bot_queue_blocked_total", "Telegram updates that waited for a full queue.", func() float64 {
+		return float64(handler.Dispatcher.Stats().Blocked)
+	})
 
 	//start server
-	go middleware.CleanupVisitors()
 
 	port := models.Config.Port
 	domain := models.Config.HostName
 
-	shorterUrlHandler := handlers.NewShortdUrlHandler(database, logger)
-	hashedUrlHandler := handlers.NewHashedUrlHandler(cache, database, logger)
+	shorterUrlHandler := handlers.NewShortdUrlHandler(shortener, logger)
+	hashedUrlHandler := handlers.NewHashedUrlHandler(cache, database, logger, clicks)
+	statsHandler := handlers.NewStatsHandler(database, reporter, logger)
+	linksHandler := handlers.NewLinksHandler(links, logger)
+	apiHandler := handlers.NewApiV1Handler(database, shortener, links, reporter, logger)
+
+	authenticate := middleware.AuthSchemeMiddleware(map[string]func(http.Handler) http.Handler{
+		"Bearer": middleware.ApiKeyMiddleware(keys, models.Config.ServiceKey),
+		"tma":    middleware.InitDataMiddleware(botToken, middleware.DefaultInitDataMaxAge),
+	})
+
+	migrations := health.Tables(database, models.Tables)
+	if models.Config.DatabaseDriver == "supabase" {
+		runner, err := newRunner(databaseUrl, databaseApiKey, io.Discard)
+		if err != nil {
+			log.Fatalf("❌ Failed to load migrations: %v", err)
+		}
+		migrations = health.Migrations(runner)
+	}
+
+	healthHandler := health.NewHandler(models.Config.Summary(),
+		health.Database(database),
+		health.Cached(migrations, time.Minute),
+		health.Cached(health.Telegram(handler.Bot), time.Minute),
+	)
+
+	trustedProxies, err := middleware.ParseNetworks(models.Config.TrustedProxies)
+	if err != nil {
+		log.Fatalf("❌ Invalid trusted_proxies: %v", err)
+	}
 
 	r := mux.NewRouter()
+	r.Use(middleware.ClientIPMiddleware(middleware.NewIPResolver(trustedProxies)))
+	if models.Config.AccessLog {
+		r.Use(middleware.AccessLogMiddleware(log.New(os.Stdout, "", log.LstdFlags)))
+	}
 
-	go r.Handle("/short", middleware.TelegramIDMiddleware(http.HandlerFunc(shorterUrlHandler.HandlerUrlShort)))
-	go r.HandleFunc("/{url:[0-9]+}", hashedUrlHandler.HandlerHashUrl)
+	// probes are not rate limited
+	r.HandleFunc("/healthz", healthHandler.HandlerHealthz).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/readyz", healthHandler.HandlerReadyz).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/version", healthHandler.HandlerVersion).Methods(http.MethodGet, http.MethodHead)
+	r.Handle("/metrics", metrics.Handler(models.Config.MetricsToken)).Methods(http.MethodGet)
 
-	r.Use(middleware.RateLimitMiddleware)
+	switch models.Config.BotMode {
+	case "polling":
+		// getUpdates is refused while a webhook of a previous run is set
+		if err := handler.DeleteWebhook(); err != nil {
+			log.Fatalf("❌ Failed to delete webhook: %v", err)
+		}
+		workers.Go("bot", handler.Run)
+
+	case "webhook":
+		updates := make(chan tgbotapi.Update, 100)
+		webhookPath := bot.WebhookPath(botToken)
+
+		// Telegram delivers every update from a few IPs, so the webhook is
+		// not rate limited
+		r.Handle(webhookPath, bot.WebhookHandler(models.Config.WebhookSecret, updates))
+
+		if err := handler.SetWebhook(webhookUrl+webhookPath, models.Config.WebhookSecret); err != nil {
+			log.Fatalf("❌ Failed to set webhook: %v", err)
+		}
+
+		// the servers are shut down before the bot, so nothing sends on
+		// updates once it is closed
+		workers.Go("bot", func(ctx context.Context) error {
+			handler.Serve(ctx, updates, func() { close(updates) })
+			return handler.DeleteWebhook()
+		})
+	}
+
+	allowlist, err := middleware.ParseNetworks(models.Config.RateLimitAllowlist)
+	if err != nil {
+		log.Fatalf("❌ Invalid rate_limit_allowlist: %v", err)
+	}
+	redirectLimit := middleware.RateLimitMiddleware(limiterStore, ratePolicy("redirect"), allowlist)
+	createLimit := middleware.RateLimitMiddleware(limiterStore, ratePolicy("create"), allowlist)
+	apiLimit := middleware.RateLimitMiddleware(limiterStore, ratePolicy("api"), allowlist)
+
+	// the api and create policies count by verified identities, so they run
+	// after the authentication
+	authenticated := func(next http.Handler) http.Handler {
+		return authenticate(apiLimit(next))
+	}
+
+	api := r.NewRoute().Subrouter()
+	api.Handle("/short", authenticated(createLimit(http.HandlerFunc(shorterUrlHandler.HandlerUrlShort))))
+	api.Handle("/stats/{url}", authenticated(http.HandlerFunc(statsHandler.HandlerStats)))
+	api.Handle("/api/links/{url}", authenticated(http.HandlerFunc(linksHandler.HandlerEditLink)))
+	apiHandler.RegisterRoutes(api, authenticated, createLimit)
+
+	r.Handle("/"+shortcode.RoutePattern(alphabet, models.Config.CodeCaseInsensitive), redirectLimit(http.HandlerFunc(hashedUrlHandler.HandlerHashUrl)))
 
 	switch port {
 	case "443":
@@ -100,30 +269,107 @@ func main() {
 			HostPolicy: autocert.HostWhitelist(domain),
 		}
 
-		go func() {
-			err := http.ListenAndServe(":80", certManager.HTTPHandler(nil))
-			if err != nil {
-				log.Fatalf("❌ HTTP challenge server failed: %v", err)
-			}
-		}()
+		challengeServer := &http.Server{
+			Addr:    ":80",
+			Handler: certManager.HTTPHandler(nil),
+		}
+		workers.Go("http challenge server", lifecycle.Server(challengeServer, challengeServer.ListenAndServe, shutdownTimeout))
 
 		server := &http.Server{
 			Addr:      ":443",
 			Handler:   r,
 			TLSConfig: certManager.TLSConfig(),
 		}
+		workers.Go("https server", lifecycle.Server(server, func() error {
+			return server.ListenAndServeTLS("", "")
+		}, shutdownTimeout))
 
-		if err := server.ListenAndServeTLS("", ""); err != nil {
-			log.Fatalf("❌ HTTPS server failed: %v", err)
-		} else {
-			fmt.Println("Server is listening")
+	default:
+		server := &http.Server{
+			Addr:    ":" + port,
+			Handler: r,
 		}
+		workers.Go("http server", lifecycle.Server(server, server.ListenAndServe, shutdownTimeout))
+	}
+
+	fmt.Println("Server is listening")
+
+	// servers stop first, then the bot, and the log and click writers
+	// flush last
+	if err := workers.Wait(ctx, shutdownTimeout); err != nil {
+		log.Fatalf("❌ Shutdown: %v", err)
+	}
+	fmt.Println("Server stopped")
+}
+
+// healthcheck probes /healthz of the running server for the Docker
+// HEALTHCHECK and returns the exit code.
+func healthcheck() int {
+	client := &http.Client{Timeout: 3 * time.Second}
+	url := "http://127.0.0.1:" + models.Config.Port + "/healthz"
+
+	if models.Config.Port == "443" {
+		// the certificate is issued for host_name, not for the loopback address
+		url = "https://127.0.0.1/healthz"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{
+			ServerName:         models.Config.HostName,
+			InsecureSkipVerify: true,
+		}}
+	}
 
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Println("❌ " + err.Error())
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("❌ " + resp.Status)
+		return 1
+	}
+	return 0
+}
+
+// migrate applies the pending migrations before anything uses the database.
+func migrate(databaseUrl, databaseApiKey string) error {
+	runner, err := newRunner(databaseUrl, databaseApiKey, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	applied, err := runner.Up(0)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Database schema is up to date, %d migrations applied\n", len(applied))
+	return nil
+}
+
+// ratePolicy reads the rate-limit policy name from the config.
+func ratePolicy(name string) middleware.Policy {
+	limit := models.Config.RateLimits[name]
+
+	period, err := time.ParseDuration(limit.Period)
+	if err != nil || period <= 0 {
+		log.Fatalf("❌ Invalid rate_limits.%s.period %q", name, limit.Period)
+	}
+	switch limit.Key {
+	case middleware.KeyIP, middleware.KeyTelegramID, middleware.KeyApiKey:
 	default:
-		if err := http.ListenAndServe(":"+models.Config.Port, r); err != nil {
-			log.Fatalf("❌ HTTP challenge server failed: %v", err)
-		} else {
-			fmt.Println("Server is listening")
+		log.Fatalf("❌ Invalid rate_limits.%s.key %q", name, limit.Key)
+	}
+
+	return middleware.Policy{Name: name, Requests: limit.Requests, Period: period, Burst: limit.Burst, Key: limit.Key}
+}
+
+func openDatabase(databaseUrl, databaseApiKey string) database.SupabaseClient {
+	if models.Config.DatabaseDriver == "sqlite" {
+		client, err := database.NewSqliteClient(models.Config.DatabasePath)
+		if err != nil {
+			log.Fatalf("❌ Failed to open sqlite database: %v", err)
 		}
+		return client
 	}
+	return database.NewClient(databaseUrl, databaseApiKey)
 }